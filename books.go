@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Book returns the book the spell is in, which is the folder it is in within
+// its grimoire, or "" if it isn't in one.
+func (r spellRef) Book() string {
+	book := path.Dir(filepath.ToSlash(r.Name))
+	if book == "." {
+		return ""
+	}
+	return book
+}
+
+// checkBook returns an error if book can't be used to hold spells, such as a
+// path outside the grimoire or one that would be skipped by listSpells.
+func checkBook(book string) error {
+	if book == "" {
+		return nil
+	}
+
+	if path.IsAbs(book) || path.Clean(book) != book {
+		return fmt.Errorf("invalid book %s, expected a path such as k8s or k8s/deploy", book)
+	}
+
+	// Only the forgotten folder at the top of the grimoire is set aside, so a
+	// book within another can still be called forgotten
+	for i, part := range strings.Split(book, "/") {
+		if part == ".." || strings.HasPrefix(part, ".") || (i == 0 && part == forgottenDir) {
+			return fmt.Errorf("invalid book %s, %s can't hold spells", book, part)
+		}
+	}
+
+	return nil
+}
+
+// inBook returns the spells that are in book or one of the books within it.
+// Every spell is in the book "".
+func inBook(refs []spellRef, book string) []spellRef {
+	if book == "" {
+		return refs
+	}
+
+	var filtered []spellRef
+	for _, ref := range refs {
+		if b := ref.Book(); b == book || strings.HasPrefix(b, book+"/") {
+			filtered = append(filtered, ref)
+		}
+	}
+
+	return filtered
+}
+
+// moveCommand moves a spell into another book within its grimoire. The book
+// "." is the top of the grimoire.
+func moveCommand(conf Config, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return usageErrorf("usage: move [spell] <book>")
+	}
+
+	book := args[len(args)-1]
+	if book == "." {
+		book = ""
+	}
+	if err := checkBook(book); err != nil {
+		return err
+	}
+
+	ref, err := selectSpell(conf, "", args[:len(args)-1])
+	if err != nil {
+		return err
+	}
+
+	if err := checkWritable(ref, "move"); err != nil {
+		return err
+	}
+
+	moved := spellRef{Name: path.Join(book, path.Base(ref.Name)), Grimoire: ref.Grimoire}
+	if moved.Name == ref.Name {
+		return nil
+	}
+
+	if _, err := os.Stat(moved.Path()); err == nil {
+		return fmt.Errorf("spell %s already exists", moved.Name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(moved.Path()), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(ref.Path(), moved.Path()); err != nil {
+		return err
+	}
+
+	// Leave no empty books behind. Removing a book that isn't empty fails
+	// harmlessly, and so do the books it is within.
+	for book := ref.Book(); book != "" && book != "."; book = path.Dir(book) {
+		if os.Remove(filepath.Join(ref.Grimoire.Path, book)) != nil {
+			break
+		}
+	}
+
+	fmt.Printf("Moved %s to %s\n", ref.Name, moved.Name)
+
+	autoCommit(conf, ref.Grimoire, fmt.Sprintf("Move spell %s to %s", ref.Name, moved.Name), ref.Name, moved.Name)
+
+	return nil
+}
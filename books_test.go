@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestCheckBook(t *testing.T) {
+	var testCases = []struct {
+		name string
+		book string
+
+		err error
+	}{
+		{
+			name: "ok - top of the grimoire",
+			book: "",
+		},
+		{
+			name: "ok - nested",
+			book: "k8s/deploy",
+		},
+		{
+			name: "ok - forgotten within another book",
+			book: "ops/forgotten",
+		},
+		{
+			name: "error - absolute",
+			book: "/k8s",
+
+			err: fmt.Errorf("invalid book /k8s, expected a path such as k8s or k8s/deploy"),
+		},
+		{
+			name: "error - outside the grimoire",
+			book: "../k8s",
+
+			err: fmt.Errorf("invalid book ../k8s, .. can't hold spells"),
+		},
+		{
+			name: "error - hidden",
+			book: "k8s/.git",
+
+			err: fmt.Errorf("invalid book k8s/.git, .git can't hold spells"),
+		},
+		{
+			name: "error - forgotten",
+			book: "forgotten",
+
+			err: fmt.Errorf("invalid book forgotten, forgotten can't hold spells"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkBook(tc.book)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestInBook(t *testing.T) {
+	var refs []spellRef
+	for _, name := range []string{"pods", "k8s/restart", "k8s/deploy/rollout", "k8sx/other"} {
+		refs = append(refs, spellRef{Name: name})
+	}
+
+	var testCases = []struct {
+		name string
+		book string
+
+		want []string
+	}{
+		{
+			name: "every book",
+			book: "",
+
+			want: []string{"pods", "k8s/restart", "k8s/deploy/rollout", "k8sx/other"},
+		},
+		{
+			name: "book and the books within it",
+			book: "k8s",
+
+			want: []string{"k8s/restart", "k8s/deploy/rollout"},
+		},
+		{
+			name: "nested book",
+			book: "k8s/deploy",
+
+			want: []string{"k8s/deploy/rollout"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var result []string
+			for _, ref := range inBook(refs, tc.book) {
+				result = append(result, ref.Name)
+			}
+
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+		})
+	}
+}
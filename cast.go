@@ -0,0 +1,481 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Incantation is a spell with all of its parameters substituted, ready to be
+// cast.
+type Incantation struct {
+	Name string
+	// Ref is where the spell was read from, see Entry.Ref.
+	Ref         string
+	Command     string
+	Dir         string
+	Env         []string
+	Interpreter string
+	Params      map[string]string
+	// Timeout is how long the spell may run before it is killed, or zero
+	// for no limit.
+	Timeout time.Duration
+	// Step is the name of the runbook step being cast, if any.
+	Step string
+	// PreCast and PostCast are hook commands run before and after the
+	// spell is cast.
+	PreCast  []string
+	PostCast []string
+}
+
+// spellTemplate holds every part of an entry that may contain parameters.
+type spellTemplate struct {
+	Spell *Spell
+	Dir   *Spell
+	Env   []*Spell
+	Steps []*Spell
+}
+
+func parseTemplate(entry Entry) (*spellTemplate, error) {
+	if entry.Spell == "" && len(entry.Steps) == 0 {
+		return nil, parseErrorf("spell %s has no incantation", entry.Name)
+	}
+
+	var t spellTemplate
+	var err error
+
+	t.Spell, err = ParseSpell(entry.Spell)
+	if err != nil {
+		return nil, parseErrorf("spell %s: %v", entry.Name, err)
+	}
+
+	t.Dir, err = ParseSpell(entry.Dir)
+	if err != nil {
+		return nil, parseErrorf("spell %s: Dir: %v", entry.Name, err)
+	}
+
+	for _, env := range entry.Env {
+		spell, err := ParseSpell(env)
+		if err != nil {
+			return nil, parseErrorf("spell %s: Env: %v", entry.Name, err)
+		}
+		t.Env = append(t.Env, spell)
+	}
+
+	for _, step := range entry.Steps {
+		spell, err := ParseSpell(step.Command)
+		if err != nil {
+			return nil, parseErrorf("spell %s: Step %s: %v", entry.Name, step.Name, err)
+		}
+		t.Steps = append(t.Steps, spell)
+	}
+
+	return &t, nil
+}
+
+// Params returns the parameters used anywhere in the template.
+func (t *spellTemplate) Params() ([]Param, error) {
+	spells := append([]*Spell{t.Spell, t.Dir}, t.Env...)
+	return MergeParams(append(spells, t.Steps...)...)
+}
+
+// paramFlag collects the name=value pairs given with repeated -p flags.
+type paramFlag map[string]string
+
+func (p paramFlag) String() string {
+	return formatContext(p)
+}
+
+func (p paramFlag) Set(value string) error {
+	name, value, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value")
+	}
+	p[name] = value
+	return nil
+}
+
+// prepareIncantation substitutes parameter values into every part of the
+// entry. Values for parameters not given in preset are prompted for.
+func prepareIncantation(conf Config, entry Entry, preset map[string]string) (*Incantation, error) {
+	t, values, err := resolveParams(conf, entry, preset)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Incantation(conf, entry, values)
+}
+
+// resolveParams parses the entry and returns a value for each of its
+// parameters, taken from preset or else prompted for.
+func resolveParams(conf Config, entry Entry, preset map[string]string) (*spellTemplate, map[string]string, error) {
+	t, err := parseTemplate(entry)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params, err := t.Params()
+	if err != nil {
+		return nil, nil, parseErrorf("spell %s: %v", entry.Name, err)
+	}
+
+	values := make(map[string]string)
+	var unset []Param
+	for _, param := range params {
+		if value, ok := preset[param.Name]; ok {
+			values[param.Name] = value
+		} else {
+			unset = append(unset, param)
+		}
+	}
+
+	if len(values) < len(preset) {
+		for name := range preset {
+			if _, ok := values[name]; !ok {
+				return nil, nil, usageErrorf("spell %s has no parameter %s", entry.Name, name)
+			}
+		}
+	}
+
+	if len(unset) > 0 {
+		ctx, err := activeContext(conf.StatePath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Runbooks have steps rather than a single spell to show
+		casting := entry.Spell
+		if casting == "" {
+			casting = entry.Name
+		}
+
+		fmt.Fprintf(promptOut, "Casting: %s\n", casting)
+		prompted, err := promptSpellParameters(unset, ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for name, value := range prompted {
+			values[name] = value
+		}
+	}
+
+	return t, values, nil
+}
+
+// Incantation substitutes values into every part of the template.
+func (t *spellTemplate) Incantation(conf Config, entry Entry, values map[string]string) (*Incantation, error) {
+	var err error
+
+	inc := Incantation{
+		Name:        entry.Name,
+		Ref:         entry.Ref,
+		Interpreter: entry.Interpreter,
+		Params:      values,
+		Timeout:     entry.Timeout,
+		PreCast:     append(slices.Clone(conf.PreCast), entry.PreCast...),
+		PostCast:    append(slices.Clone(conf.PostCast), entry.PostCast...),
+	}
+	if inc.Interpreter == "" {
+		inc.Interpreter = conf.Interpreter
+	}
+
+	inc.Command, err = t.Spell.Substitute(values)
+	if err != nil {
+		return nil, err
+	}
+
+	inc.Dir, err = t.Dir.Substitute(values)
+	if err != nil {
+		return nil, err
+	}
+	inc.Dir = expandHome(inc.Dir)
+	if entry.Root != "" && !filepath.IsAbs(inc.Dir) {
+		inc.Dir = filepath.Join(entry.Root, inc.Dir)
+	}
+
+	for _, env := range t.Env {
+		value, err := env.Substitute(values)
+		if err != nil {
+			return nil, err
+		}
+		inc.Env = append(inc.Env, value)
+	}
+
+	return &inc, nil
+}
+
+// expandHome replaces a leading ~ in path with the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+func castCommand(conf Config, args []string) error {
+	var yes, print, copy, background bool
+	var each, book string
+	var timeout time.Duration
+	jobs := conf.Jobs
+	params := make(paramFlag)
+	flagSet := flag.NewFlagSet("cast", flag.ExitOnError)
+	flagSet.StringVar(&each, "each", "", "Cast once for each of the values given as param=a,b,c, param=@file or param=- for stdin")
+	flagSet.IntVar(&jobs, "jobs", jobs, "How many casts to run at once with --each")
+	flagSet.DurationVar(&timeout, "timeout", 0, "Kill the spell if it runs for longer than this, such as 30s or 5m")
+	flagSet.BoolVar(&background, "background", false, "Cast in the background, see the jobs command")
+	flagSet.Var(params, "p", "Substitute a parameter with name=value rather than prompting for it")
+	flagSet.BoolVar(&yes, "yes", false, "Cast without asking for confirmation")
+	flagSet.BoolVar(&print, "print", false, "Print the final command instead of casting it, for shell integration")
+	flagSet.BoolVar(&copy, "copy", false, "Copy the final command to the clipboard instead of casting it")
+	flagSet.StringVar(&book, "b", "", "Only find spells in the given book, such as k8s")
+	flagSet.Parse(args)
+
+	// Get the remaining positional arguments
+	args = flagSet.Args()
+
+	// The final command is printed to stdout, so the shell capturing it
+	// mustn't also capture the prompts
+	if print {
+		usePromptTTY()
+	}
+
+	if each != "" && (print || copy) {
+		return usageErrorf("--each can't be used with --print or --copy")
+	}
+
+	if background && (print || copy || each != "") {
+		return usageErrorf("--background can't be used with --print, --copy or --each")
+	}
+
+	ref, err := selectSpell(conf, book, args)
+	if err != nil {
+		return err
+	}
+
+	entry, err := readSpellRef(ref)
+	if err != nil {
+		return fmt.Errorf("failed to read spell %s: %w", ref.Name, err)
+	}
+
+	if timeout > 0 {
+		entry.Timeout = timeout
+	}
+
+	if len(entry.Steps) > 0 {
+		if print || copy || each != "" || background {
+			return usageErrorf("runbook %s can only be cast one step at a time", entry.Name)
+		}
+		return castRunbook(conf, entry, params, yes)
+	}
+
+	if each != "" {
+		// Values read from stdin leave only the terminal to prompt on
+		if strings.HasSuffix(each, "=-") {
+			usePromptTTY()
+		}
+
+		name, values, err := parseEach(each, os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		incs, err := fanOutIncantations(conf, entry, params, name, values)
+		if err != nil {
+			return err
+		}
+
+		if err := confirmFanOut(conf, entry, incs, yes); err != nil {
+			return err
+		}
+
+		return castFanOut(conf, name, incs, jobs)
+	}
+
+	inc, err := prepareIncantation(conf, entry, params)
+	if err != nil {
+		return err
+	}
+
+	// The command isn't cast by grimoire, but placed on the shell's command
+	// line where it can still be changed before it's run.
+	if print {
+		fmt.Print(inc.Command)
+		return nil
+	}
+
+	if copy {
+		return copyIncantation(inc)
+	}
+
+	if err := confirmIncantation(conf, entry, inc, yes); err != nil {
+		return err
+	}
+
+	if background {
+		return castInBackground(conf, inc)
+	}
+
+	return castIncantation(conf, inc)
+}
+
+// copyIncantation copies the final command to the terminal's clipboard.
+func copyIncantation(inc *Incantation) error {
+	if err := copyToClipboard(inc.Command); err != nil {
+		return fmt.Errorf("copying to clipboard: %w", err)
+	}
+
+	fmt.Fprintf(promptOut, "Copied to clipboard: %s\n", inc.Command)
+
+	return nil
+}
+
+// confirmIncantation shows the final command and, if the spell or config asks
+// for it and yes isn't set, lets the user edit or cancel it before it's cast.
+// Dangerous commands always need a typed confirmation, even with yes set.
+func confirmIncantation(conf Config, entry Entry, inc *Incantation, yes bool) error {
+	if !yes && (conf.Confirm || entry.Confirm) {
+		command, ok, err := confirmCast(inc.Command)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Spell cancelled")
+			return errCancelled
+		}
+		inc.Command = command
+	} else {
+		fmt.Printf("%s\n", inc.Command)
+	}
+
+	if matches := checkDanger(conf.DangerRules, inc.Command, entry.Allow); len(matches) > 0 {
+		ok, err := confirmDanger(inc.Name, inc.Command, matches)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Spell cancelled")
+			return errCancelled
+		}
+	}
+
+	return nil
+}
+
+// incantationCommand returns the command that casts the incantation, attached
+// to grimoire's own stdin, stdout and stderr.
+func incantationCommand(inc *Incantation) (*exec.Cmd, error) {
+	argv, scriptOnStdin, err := interpreterArgs(inc.Interpreter, inc.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Dir = inc.Dir
+	if len(inc.Env) > 0 {
+		cmd.Env = append(os.Environ(), inc.Env...)
+	}
+	cmd.Stdin = os.Stdin
+	if scriptOnStdin {
+		cmd.Stdin = strings.NewReader(inc.Command)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd, nil
+}
+
+// castIncantation runs the incantation between its hooks and records it in the
+// history log. A spell that exits unsuccessfully results in a
+// spellFailedError.
+func castIncantation(conf Config, inc *Incantation) error {
+	// Start a subprocess to run the spell
+	cmd, err := incantationCommand(inc)
+	if err != nil {
+		return err
+	}
+
+	code, timedOut, start, err := runHooked(conf, inc, cmd)
+	if err != nil {
+		return err
+	}
+
+	notifyCast(conf, inc, code, time.Since(start))
+
+	if timedOut {
+		fmt.Fprintf(os.Stderr, "Spell casting fizzled: timed out after %s\n", inc.Timeout)
+		return &spellFailedError{code: code}
+	}
+
+	if code != 0 {
+		fmt.Fprintf(os.Stderr, "Spell casting fizzled: exit status %d\n", code)
+		return &spellFailedError{code: code}
+	}
+
+	return nil
+}
+
+// runHooked runs cmd to cast the incantation, after its pre-cast hooks and
+// before its post-cast hooks, and records the cast in the history log. It
+// returns the spell's exit code, whether it was killed for timing out, and
+// when it started. If a pre-cast hook fails, the spell isn't cast.
+func runHooked(conf Config, inc *Incantation, cmd *exec.Cmd) (int, bool, time.Time, error) {
+	if err := runHooks(inc.PreCast, hookEnv(inc, false, 0, 0)); err != nil {
+		return 0, false, time.Time{}, fmt.Errorf("not casting %s, pre-cast %v", inc.Name, err)
+	}
+
+	start := time.Now()
+	code, timedOut, err := runCommand(cmd, inc.Timeout)
+	if err != nil {
+		return 0, false, start, fmt.Errorf("spell casting fizzled: %v", err)
+	}
+
+	recordCast(conf, inc, start, code)
+
+	// The spell has already been cast, so a failing hook is only a warning
+	if err := runHooks(inc.PostCast, hookEnv(inc, true, code, time.Since(start))); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: post-cast %v\n", err)
+	}
+
+	return code, timedOut, start, nil
+}
+
+// recordCast adds a cast that started at start and exited with code to the
+// history log.
+func recordCast(conf Config, inc *Incantation, start time.Time, code int) {
+	record := Record{
+		Time:        start,
+		Name:        inc.Name,
+		Ref:         inc.Ref,
+		Step:        inc.Step,
+		Params:      inc.Params,
+		Command:     inc.Command,
+		Interpreter: inc.Interpreter,
+		Env:         envNames(inc.Env),
+		Cwd:         inc.Dir,
+		Timeout:     inc.Timeout,
+		ExitCode:    code,
+		Duration:    time.Since(start),
+	}
+	if record.Cwd == "" {
+		record.Cwd, _ = os.Getwd()
+	} else {
+		record.Cwd, _ = filepath.Abs(record.Cwd)
+	}
+
+	// Failing to record the cast shouldn't hide how the spell itself went
+	if err := appendHistory(conf.StatePath, record); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: recording history: %v\n", err)
+	}
+}
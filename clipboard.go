@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+)
+
+// osc52 returns the escape sequence asking the terminal to set its clipboard to
+// text, wrapped for tmux when running inside it.
+func osc52(text string, tmux bool) string {
+	seq := "\033]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+
+	if tmux {
+		seq = tmuxPassthrough(seq)
+	}
+
+	return seq
+}
+
+// copyToClipboard copies text to the clipboard of the terminal grimoire is
+// running in. This works over SSH without needing xclip or pbcopy, as long as
+// the terminal supports OSC 52.
+func copyToClipboard(text string) error {
+	out := os.Stderr
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		defer tty.Close()
+		out = tty
+	}
+
+	_, err := fmt.Fprint(out, osc52(text, os.Getenv("TMUX") != ""))
+	return err
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestOSC52(t *testing.T) {
+	var testCases = []struct {
+		name string
+		text string
+		tmux bool
+
+		want string
+	}{
+		{
+			name: "plain",
+			text: "echo hi",
+
+			want: "\033]52;c;ZWNobyBoaQ==\a",
+		},
+		{
+			name: "tmux passthrough",
+			text: "echo hi",
+			tmux: true,
+
+			want: "\033Ptmux;\033\033]52;c;ZWNobyBoaQ==\a\033\\",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := osc52(tc.text, tc.tmux)
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,21 @@
 package config
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path"
+	"strings"
 )
 
 var DefaultPath string
 
+// DefaultStatePath is the directory where grimoire keeps state that isn't
+// part of a spell, such as parameter contexts.
+var DefaultStatePath string
+
 func init() {
 	xdgConfigDir := os.Getenv("XDG_CONFIG_DIR")
 	if xdgConfigDir == "" {
@@ -15,4 +24,86 @@ func init() {
 	} else {
 		DefaultPath = path.Join(xdgConfigDir, ".config/grimoire.conf")
 	}
+
+	xdgStateHome := os.Getenv("XDG_STATE_HOME")
+	if xdgStateHome == "" {
+		home := os.Getenv("HOME")
+		DefaultStatePath = path.Join(home, ".local/state/grimoire")
+	} else {
+		DefaultStatePath = path.Join(xdgStateHome, "grimoire")
+	}
+}
+
+// Settings maps each key in a config file to the values it was given, in the
+// order they appeared. Keys may be repeated to build up lists.
+type Settings map[string][]string
+
+// Get returns the last value given for key, and whether it was set at all.
+func (s Settings) Get(key string) (string, bool) {
+	values := s[key]
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// Parse reads settings written in the same "Key: value" format as spells.
+// Blank lines and lines starting with # are ignored.
+func Parse(r io.Reader) (Settings, error) {
+	settings := make(Settings)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected Key: value", n)
+		}
+
+		key = strings.TrimSpace(key)
+		settings[key] = append(settings[key], strings.TrimSpace(value))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// Read parses the config file at path. A missing file is not an error and
+// results in empty settings.
+func Read(path string) (Settings, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Settings{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	settings, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return settings, nil
+}
+
+// ParseBool interprets the yes/no style values used in config files and spell
+// headers.
+func ParseBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "y", "true", "on", "1":
+		return true, nil
+	case "no", "n", "false", "off", "0", "":
+		return false, nil
+	default:
+		return false, fmt.Errorf("expected yes or no, got %q", value)
+	}
 }
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestParse(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		contents string
+
+		want Settings
+		err  error
+	}{
+		{
+			name:     "ok - empty",
+			contents: "",
+
+			want: Settings{},
+		},
+		{
+			name:     "ok - comments and blank lines",
+			contents: "# grimoire config\n\nEditor: nvim\n",
+
+			want: Settings{"Editor": {"nvim"}},
+		},
+		{
+			name:     "ok - repeated keys",
+			contents: "Danger: a\nConfirm: yes\nDanger: b",
+
+			want: Settings{"Danger": {"a", "b"}, "Confirm": {"yes"}},
+		},
+		{
+			name:     "ok - value containing colon",
+			contents: "SpellPath: /home/me/spells:old",
+
+			want: Settings{"SpellPath": {"/home/me/spells:old"}},
+		},
+		{
+			name:     "error - missing colon",
+			contents: "Editor: vi\nConfirm",
+
+			err: fmt.Errorf("line 2: expected Key: value"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Parse(strings.NewReader(tc.contents))
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Context is a named set of parameter values that are shared across spells,
+// such as the namespace, cluster, or region currently being worked in.
+type Context struct {
+	Name   string
+	Values map[string]string
+}
+
+func contextPath(statePath, name string) string {
+	return filepath.Join(statePath, "contexts", name)
+}
+
+func activeContextPath(statePath string) string {
+	return filepath.Join(statePath, "context")
+}
+
+// parseContext parses context file contents made up of param=value lines.
+func parseContext(contents string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	for i, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected param=value", i+1)
+		}
+
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("line %d: missing parameter name", i+1)
+		}
+
+		values[name] = strings.TrimSpace(value)
+	}
+
+	return values, nil
+}
+
+// formatContext formats context values as param=value lines sorted by name.
+func formatContext(values map[string]string) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s=%s\n", name, values[name])
+	}
+
+	return b.String()
+}
+
+func readContext(statePath, name string) (Context, error) {
+	contents, err := os.ReadFile(contextPath(statePath, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Context{}, fmt.Errorf("no context named %s", name)
+		}
+		return Context{}, err
+	}
+
+	values, err := parseContext(string(contents))
+	if err != nil {
+		return Context{}, fmt.Errorf("context %s: %w", name, err)
+	}
+
+	return Context{Name: name, Values: values}, nil
+}
+
+func writeContext(statePath string, ctx Context) error {
+	if err := os.MkdirAll(filepath.Dir(contextPath(statePath, ctx.Name)), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(contextPath(statePath, ctx.Name), []byte(formatContext(ctx.Values)), 0644)
+}
+
+// activeContext returns the context selected with `context use`, or nil if
+// no context is active.
+func activeContext(statePath string) (*Context, error) {
+	contents, err := os.ReadFile(activeContextPath(statePath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	name := strings.TrimSpace(string(contents))
+	if name == "" {
+		return nil, nil
+	}
+
+	ctx, err := readContext(statePath, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctx, nil
+}
+
+func contextCommand(conf Config, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("expected one of: set, use, show")
+	}
+
+	switch args[0] {
+	case "set":
+		return contextSetCommand(conf, args[1:])
+	case "use":
+		return contextUseCommand(conf, args[1:])
+	case "show":
+		return contextShowCommand(conf, args[1:])
+	default:
+		return usageErrorf("unknown context command: %s", args[0])
+	}
+}
+
+// contextSetCommand adds param=value pairs to a context, creating the context
+// if it doesn't already exist. A pair with an empty value removes the param.
+func contextSetCommand(conf Config, args []string) error {
+	if len(args) < 2 {
+		return usageErrorf("usage: context set <name> <param>=<value>...")
+	}
+
+	name := args[0]
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid context name: %s", name)
+	}
+
+	ctx, err := readContext(conf.StatePath, name)
+	if err != nil {
+		ctx = Context{Name: name, Values: make(map[string]string)}
+	}
+
+	for _, arg := range args[1:] {
+		param, value, ok := strings.Cut(arg, "=")
+		if !ok || param == "" {
+			return fmt.Errorf("expected param=value, got %s", arg)
+		}
+
+		if value == "" {
+			delete(ctx.Values, param)
+		} else {
+			ctx.Values[param] = value
+		}
+	}
+
+	return writeContext(conf.StatePath, ctx)
+}
+
+// contextUseCommand activates the named context. Without a name, the active
+// context is cleared.
+func contextUseCommand(conf Config, args []string) error {
+	if len(args) > 1 {
+		return usageErrorf("too many arguments")
+	}
+
+	if len(args) == 0 {
+		err := os.Remove(activeContextPath(conf.StatePath))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	if _, err := readContext(conf.StatePath, args[0]); err != nil {
+		return err
+	}
+
+	return os.WriteFile(activeContextPath(conf.StatePath), []byte(args[0]+"\n"), 0644)
+}
+
+// contextShowCommand prints the values of the named context, or the active
+// context if no name is given.
+func contextShowCommand(conf Config, args []string) error {
+	if len(args) > 1 {
+		return usageErrorf("too many arguments")
+	}
+
+	var ctx *Context
+	if len(args) == 1 {
+		c, err := readContext(conf.StatePath, args[0])
+		if err != nil {
+			return err
+		}
+		ctx = &c
+	} else {
+		var err error
+		ctx, err = activeContext(conf.StatePath)
+		if err != nil {
+			return err
+		}
+		if ctx == nil {
+			fmt.Println("No active context")
+			return nil
+		}
+	}
+
+	fmt.Printf("Context: %s\n", ctx.Name)
+	fmt.Print(formatContext(ctx.Values))
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestParseContext(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		contents string
+
+		want map[string]string
+		err  error
+	}{
+		{
+			name:     "ok - empty",
+			contents: "",
+
+			want: map[string]string{},
+		},
+		{
+			name:     "ok - multiple values",
+			contents: "namespace=kube-system\nregion = us-east-1\n\n",
+
+			want: map[string]string{"namespace": "kube-system", "region": "us-east-1"},
+		},
+		{
+			name:     "ok - value containing equals",
+			contents: "selector=app=web",
+
+			want: map[string]string{"selector": "app=web"},
+		},
+		{
+			name:     "error - missing equals",
+			contents: "namespace=default\ncluster",
+
+			err: fmt.Errorf("line 2: expected param=value"),
+		},
+		{
+			name:     "error - missing name",
+			contents: "=default",
+
+			err: fmt.Errorf("line 1: missing parameter name"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := parseContext(tc.contents)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+		})
+	}
+}
+
+func TestFormatContext(t *testing.T) {
+	values := map[string]string{"region": "us-east-1", "cluster": "prod", "namespace": "web"}
+
+	want := "cluster=prod\nnamespace=web\nregion=us-east-1\n"
+	if got := formatContext(values); got != want {
+		t.Errorf("got '%s', want '%s'", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DangerRule is a named pattern matching commands that can do irreversible
+// damage, such as deleting files or rewriting history.
+type DangerRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DangerMatch is a portion of a command matched by a DangerRule.
+type DangerMatch struct {
+	Rule  string
+	Start int
+	End   int
+}
+
+var defaultDangerRules = []DangerRule{
+	{"rm-rf", regexp.MustCompile(`\brm\s+(?:\S+\s+)*?(?:-(?:[a-zA-Z]*[rR][a-zA-Z]*f|[a-zA-Z]*f[a-zA-Z]*[rR])[a-zA-Z]*|` +
+		// The flags can also be given separately, in either order
+		`(?:-[a-zA-Z]*[rR][a-zA-Z]*|--recursive)\s+(?:\S+\s+)*?(?:-[a-zA-Z]*f[a-zA-Z]*|--force)\b|` +
+		`(?:-[a-zA-Z]*f[a-zA-Z]*|--force)\s+(?:\S+\s+)*?(?:-[a-zA-Z]*[rR][a-zA-Z]*|--recursive)\b)`)},
+	{"dd", regexp.MustCompile(`\bdd\s+(?:\S+\s+)*?of=\S+`)},
+	{"mkfs", regexp.MustCompile(`\bmkfs(?:\.\w+)?\b`)},
+	{"write-device", regexp.MustCompile(`>\s*/dev/(?:sd|hd|vd|nvme|xvd|disk|mmcblk)\w*`)},
+	{"force-push", regexp.MustCompile(`\bgit\s+push\b.*?(?:\s--force(?:-with-lease)?\b|\s-f\b|\s\+\S+)`)},
+	{"git-reset-hard", regexp.MustCompile(`\bgit\s+reset\s+(?:\S+\s+)*?--hard\b`)},
+	{"git-clean", regexp.MustCompile(`\bgit\s+clean\s+(?:\S+\s+)*?-[a-zA-Z]*f`)},
+	{"drop", regexp.MustCompile(`(?i)\bdrop\s+(?:table|database|schema)\b`)},
+	{"truncate", regexp.MustCompile(`(?i)\btruncate\s+table\b`)},
+	{"kubectl-delete", regexp.MustCompile(`\bkubectl\s+(?:\S+\s+)*?delete\b`)},
+	{"terraform-destroy", regexp.MustCompile(`\bterraform\s+(?:\S+\s+)*?destroy\b`)},
+	{"chmod-777", regexp.MustCompile(`\bchmod\s+(?:-\S+\s+)*0?777\s+/`)},
+	{"fork-bomb", regexp.MustCompile(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`)},
+}
+
+// parseDangerRules builds the danger ruleset from the defaults and any
+// name=regex values given in the config file. A value with a default rule's
+// name replaces that rule, and an empty pattern removes it.
+func parseDangerRules(values []string) ([]DangerRule, error) {
+	rules := make([]DangerRule, len(defaultDangerRules))
+	copy(rules, defaultDangerRules)
+
+	for _, value := range values {
+		name, pattern, ok := strings.Cut(value, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected name=pattern, got %s", value)
+		}
+
+		// Remove any existing rule with the same name
+		kept := rules[:0]
+		for _, rule := range rules {
+			if rule.Name != name {
+				kept = append(kept, rule)
+			}
+		}
+		rules = kept
+
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+
+		rules = append(rules, DangerRule{Name: name, Pattern: re})
+	}
+
+	return rules, nil
+}
+
+// checkDanger returns every match of the rules against command, ordered by
+// position, skipping rules named in allow. Allowing "all" skips every rule.
+func checkDanger(rules []DangerRule, command string, allow []string) []DangerMatch {
+	allowed := make(map[string]bool)
+	for _, name := range allow {
+		allowed[name] = true
+	}
+	if allowed["all"] {
+		return nil
+	}
+
+	var matches []DangerMatch
+	for _, rule := range rules {
+		if allowed[rule.Name] {
+			continue
+		}
+
+		for _, loc := range rule.Pattern.FindAllStringIndex(command, -1) {
+			matches = append(matches, DangerMatch{Rule: rule.Name, Start: loc[0], End: loc[1]})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Start < matches[j].Start
+	})
+
+	return matches
+}
+
+// highlightDanger returns command with the matched portions shown in reverse
+// colors, the same way the selected option is shown by promptWithTabCycling.
+func highlightDanger(command string, matches []DangerMatch) string {
+	var b strings.Builder
+
+	last := 0
+	for _, match := range matches {
+		start := max(match.Start, last)
+		if start >= match.End {
+			// Already highlighted as part of an overlapping match
+			continue
+		}
+
+		b.WriteString(command[last:start])
+		b.WriteString("\033[7m" + command[start:match.End] + "\033[0m")
+		last = match.End
+	}
+	b.WriteString(command[last:])
+
+	return b.String()
+}
+
+// confirmDanger warns that command matches danger rules and requires the
+// spell's name to be typed out before it may be cast. An empty answer never
+// confirms, even if the name is somehow empty too.
+func confirmDanger(name, command string, matches []DangerMatch) (bool, error) {
+	var rules []string
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		if !seen[match.Rule] {
+			seen[match.Rule] = true
+			rules = append(rules, match.Rule)
+		}
+	}
+
+	fmt.Fprintf(promptOut, "This spell looks dangerous (%s):\n", strings.Join(rules, ", "))
+	fmt.Fprintf(promptOut, "  %s\n", highlightDanger(command, matches))
+	fmt.Fprintf(promptOut, "Type the spell name (%s) to cast it anyway: ", name)
+
+	if !input.Scan() {
+		fmt.Fprintln(promptOut)
+		return false, input.Err()
+	}
+
+	answer := strings.TrimSpace(input.Text())
+	return answer != "" && answer == name, nil
+}
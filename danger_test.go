@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestCheckDanger(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		command string
+		allow   []string
+
+		want []DangerMatch
+	}{
+		{
+			name:    "safe command",
+			command: "ls -la /tmp",
+
+			want: nil,
+		},
+		{
+			name:    "rm -rf",
+			command: "rm -rf /var/tmp/build",
+
+			want: []DangerMatch{{Rule: "rm-rf", Start: 0, End: 6}},
+		},
+		{
+			name:    "rm with separate recursive flag",
+			command: "rm -fR build",
+
+			want: []DangerMatch{{Rule: "rm-rf", Start: 0, End: 6}},
+		},
+		{
+			name:    "rm with separate flags",
+			command: "rm -r -f build",
+
+			want: []DangerMatch{{Rule: "rm-rf", Start: 0, End: 8}},
+		},
+		{
+			name:    "rm with long flags",
+			command: "rm --recursive --force build",
+
+			want: []DangerMatch{{Rule: "rm-rf", Start: 0, End: 22}},
+		},
+		{
+			name:    "rm with force before recursive",
+			command: "rm --force -v --recursive build",
+
+			want: []DangerMatch{{Rule: "rm-rf", Start: 0, End: 25}},
+		},
+		{
+			name:    "rm without force",
+			command: "rm -r build",
+
+			want: nil,
+		},
+		{
+			name:    "dd onto a device",
+			command: "dd if=image.iso of=/dev/sdb bs=4M",
+
+			want: []DangerMatch{{Rule: "dd", Start: 0, End: 27}},
+		},
+		{
+			name:    "force push",
+			command: "git push origin main --force",
+
+			want: []DangerMatch{{Rule: "force-push", Start: 0, End: 28}},
+		},
+		{
+			name:    "drop table in any case",
+			command: `psql -c "Drop Table users"`,
+
+			want: []DangerMatch{{Rule: "drop", Start: 9, End: 19}},
+		},
+		{
+			name:    "multiple matches ordered by position",
+			command: "mkfs.ext4 /dev/sdb1 && git reset --hard",
+
+			want: []DangerMatch{
+				{Rule: "mkfs", Start: 0, End: 9},
+				{Rule: "git-reset-hard", Start: 23, End: 39},
+			},
+		},
+		{
+			name:    "allowed rule",
+			command: "mkfs.ext4 /dev/sdb1 && git reset --hard",
+			allow:   []string{"mkfs"},
+
+			want: []DangerMatch{{Rule: "git-reset-hard", Start: 23, End: 39}},
+		},
+		{
+			name:    "all rules allowed",
+			command: "rm -rf /",
+			allow:   []string{"all"},
+
+			want: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := checkDanger(defaultDangerRules, tc.command, tc.allow)
+
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+		})
+	}
+}
+
+func TestParseDangerRules(t *testing.T) {
+	rules, err := parseDangerRules([]string{"kubectl-delete=", "shutdown=\\bshutdown\\b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := checkDanger(rules, "kubectl delete pod web-0", nil); got != nil {
+		t.Errorf("removed rule still matched: %#v", got)
+	}
+
+	want := []DangerMatch{{Rule: "shutdown", Start: 5, End: 13}}
+	if got := checkDanger(rules, "sudo shutdown now", nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	if _, err := parseDangerRules([]string{"broken=("}); err == nil {
+		t.Errorf("expected error for invalid pattern")
+	}
+}
+
+func TestHighlightDanger(t *testing.T) {
+	matches := []DangerMatch{
+		{Rule: "a", Start: 0, End: 5},
+		{Rule: "b", Start: 3, End: 8},
+		{Rule: "c", Start: 10, End: 12},
+	}
+
+	want := "\033[7mabcde\033[0m\033[7mfgh\033[0mij\033[7mkl\033[0mmn"
+	if got := highlightDanger("abcdefghijklmn", matches); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestConfirmDanger(t *testing.T) {
+	var testCases = []struct {
+		name   string
+		spell  string
+		answer string
+
+		want bool
+	}{
+		{
+			name:   "name typed",
+			spell:  "wipe",
+			answer: "wipe\n",
+
+			want: true,
+		},
+		{
+			name:   "wrong name",
+			spell:  "wipe",
+			answer: "wip\n",
+
+			want: false,
+		},
+		{
+			name:   "empty answer",
+			spell:  "",
+			answer: "\n",
+
+			want: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldInput, oldOut := input, promptOut
+			t.Cleanup(func() { input, promptOut = oldInput, oldOut })
+			input = bufio.NewScanner(strings.NewReader(tc.answer))
+			devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer devNull.Close()
+			promptOut = devNull
+
+			matches := []DangerMatch{{Rule: "rm-rf", Start: 0, End: 6}}
+			got, err := confirmDanger(tc.spell, "rm -rf /", matches)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
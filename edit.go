@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// problemPrefix starts the lines that edit adds to an invalid spell to say
+// what is wrong with it. They are removed before the spell is checked again.
+const problemPrefix = "#! "
+
+// spellHeaders are the headers a spell file can have.
+var spellHeaders = []string{
+	"Spell", "Name", "Description", "Tags", "Interpreter", "Shell", "Dir", "Env",
+	"Step", "PreCast", "PostCast", "Timeout", "Allow", "Confirm",
+}
+
+// checkSpellName returns an error if name can't be used as a spell's name.
+// Spells are put in books with move rather than by naming them with a path.
+func checkSpellName(name string) error {
+	if name == "" {
+		return fmt.Errorf("a spell's name can't be empty")
+	}
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("invalid name %s, use move to put a spell in a book", name)
+	}
+	if strings.HasPrefix(name, ".") || name == forgottenDir {
+		return fmt.Errorf("invalid name %s, it would be hidden from the grimoire", name)
+	}
+	return nil
+}
+
+// spellProblems checks the contents of a spell file for anything that would
+// otherwise only be found when it is cast, such as a misspelled header or a
+// broken parameter.
+func spellProblems(contents string) []string {
+	var problems []string
+
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Headers are only read with a space after the colon, so one
+		// without is as good as missing
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			problems = append(problems, fmt.Sprintf("expected a header such as Name: value, got %q", line))
+		} else if !slices.Contains(spellHeaders, key) {
+			problems = append(problems, fmt.Sprintf("unknown header %q", key))
+		} else if value != "" && !strings.HasPrefix(value, " ") {
+			problems = append(problems, fmt.Sprintf("expected a space after %s:, got %q", key, line))
+		}
+	}
+
+	entry, err := parseEntry(contents)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+
+	// A spell without a Name header is known by its file
+	if entry.Name != "" {
+		if err := checkSpellName(entry.Name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if _, err := parseTemplate(entry); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	return problems
+}
+
+// stripProblems removes the lines added by annotateProblems.
+func stripProblems(contents string) string {
+	lines := strings.SplitAfter(contents, "\n")
+	lines = slices.DeleteFunc(lines, func(line string) bool {
+		return strings.HasPrefix(line, problemPrefix)
+	})
+	return strings.Join(lines, "")
+}
+
+// annotateProblems adds the problems to the top of a spell file, so they can
+// be seen when it is reopened in the editor.
+func annotateProblems(contents string, problems []string) string {
+	var b strings.Builder
+	b.WriteString(problemPrefix + "The spell wasn't saved:\n")
+	for _, problem := range problems {
+		b.WriteString(problemPrefix + "  " + problem + "\n")
+	}
+	b.WriteString(problemPrefix + "Fix it, or quit without changes to discard the edit.\n")
+	b.WriteString(contents)
+	return b.String()
+}
+
+// spellEditor returns the editor to edit spells with, falling back to vi if
+// none is configured.
+func spellEditor(conf Config) string {
+	if conf.Editor == "" {
+		return "vi"
+	}
+	return conf.Editor
+}
+
+// editSpell opens a temporary copy of a spell in the editor, reopening it for
+// as long as the edited spell is invalid. The spell is only replaced once it
+// is valid, and is renamed if its Name header changed. The returned ref is
+// where the spell is afterwards.
+func editSpell(editor string, ref spellRef) (spellRef, error) {
+	original, err := os.ReadFile(ref.Path())
+	if err != nil {
+		return ref, err
+	}
+
+	// A spell's file needn't match its Name header, so it is only renamed
+	// when the header itself changes
+	name := path.Base(ref.Name)
+	if entry, err := parseEntry(string(original)); err == nil && entry.Name != "" {
+		name = entry.Name
+	}
+
+	info, err := os.Stat(ref.Path())
+	if err != nil {
+		return ref, err
+	}
+
+	// The copy is hidden beside the spell, so it can be renamed over it
+	tmp, err := os.CreateTemp(filepath.Dir(ref.Path()), "."+path.Base(ref.Name)+".*")
+	if err != nil {
+		return ref, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return ref, err
+	}
+
+	shown := string(original)
+	var problems []string
+	for {
+		if err := os.WriteFile(tmp.Name(), []byte(shown), 0644); err != nil {
+			return ref, err
+		}
+
+		cmd := exec.Command(editor, tmp.Name())
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return ref, fmt.Errorf("editor misfire: %v", err)
+		}
+
+		edited, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return ref, err
+		}
+
+		// Quitting without changes leaves the spell as it was
+		if string(edited) == shown {
+			if problems != nil {
+				return ref, parseErrorf("spell %s not saved: %s", ref.Name, strings.Join(problems, "; "))
+			}
+			return ref, nil
+		}
+
+		contents := stripProblems(string(edited))
+		problems = spellProblems(contents)
+
+		saved := ref
+		if len(problems) == 0 {
+			// Removing the Name header leaves the spell known by its file
+			entry, _ := parseEntry(contents)
+			if entry.Name != "" && entry.Name != name {
+				saved = spellRef{Name: path.Join(ref.Book(), entry.Name), Grimoire: ref.Grimoire}
+				if _, err := os.Stat(saved.Path()); err == nil {
+					problems = append(problems, fmt.Sprintf("spell %s already exists", saved.Name))
+				}
+			}
+		}
+
+		if len(problems) > 0 {
+			shown = annotateProblems(contents, problems)
+			continue
+		}
+
+		if err := os.WriteFile(tmp.Name(), []byte(contents), 0644); err != nil {
+			return ref, err
+		}
+
+		if err := os.Rename(tmp.Name(), saved.Path()); err != nil {
+			return ref, err
+		}
+
+		if saved != ref {
+			if err := os.Remove(ref.Path()); err != nil {
+				return saved, err
+			}
+		}
+
+		return saved, nil
+	}
+}
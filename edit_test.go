@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestSpellProblems(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		contents string
+
+		want []string
+	}{
+		{
+			name:     "valid",
+			contents: "# Lists pods\nSpell: kubectl get pods -n <ns>\nName: pods\nDescription:\n",
+		},
+		{
+			name:     "runbook",
+			contents: "Name: deploy\nStep: build: make\nStep: make deploy\n",
+		},
+		{
+			name:     "misspelled header",
+			contents: "Spell: ls\nName: ls\nDescripton: list\n",
+
+			want: []string{`unknown header "Descripton"`},
+		},
+		{
+			name:     "not a header",
+			contents: "Spell: ls\nName: ls\nls -la\n",
+
+			want: []string{`expected a header such as Name: value, got "ls -la"`},
+		},
+		{
+			name:     "no space after the colon",
+			contents: "Spell: ls\nName: ls\nDescription:typo\nTimeout:5s\nTags:a,b\n",
+
+			want: []string{
+				`expected a space after Description:, got "Description:typo"`,
+				`expected a space after Timeout:, got "Timeout:5s"`,
+				`expected a space after Tags:, got "Tags:a,b"`,
+			},
+		},
+		{
+			name:     "no space after Spell",
+			contents: "Spell:ls\nName: ls\n",
+
+			want: []string{`expected a space after Spell:, got "Spell:ls"`, "spell ls has no incantation"},
+		},
+		{
+			name:     "bad header value",
+			contents: "Spell: sleep 60\nName: nap\nTimeout: soon\n",
+
+			want: []string{`Timeout: time: invalid duration "soon"`},
+		},
+		{
+			name:     "no name",
+			contents: "Spell: ls\nDescription: x\n",
+		},
+		{
+			name:     "name with a book",
+			contents: "Spell: ls\nName: k8s/ls\n",
+
+			want: []string{"invalid name k8s/ls, use move to put a spell in a book"},
+		},
+		{
+			name:     "no incantation",
+			contents: "Name: empty\n",
+
+			want: []string{"spell empty has no incantation"},
+		},
+		{
+			name:     "repeated default",
+			contents: "Spell: echo <a=1> <a=2>\nName: echo\n",
+
+			want: []string{"spell echo: parameter 'a' appears multiple times with default values - defaults only allowed on first occurrence"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := spellProblems(tc.contents)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", got, tc.want, test.Diff(got, tc.want))
+			}
+		})
+	}
+}
+
+func TestEditSpell(t *testing.T) {
+	dir := t.TempDir()
+
+	// The editor breaks the spell, then fixes it once told what is wrong, and
+	// gives up if the name it fixed it with is taken
+	editor := filepath.Join(dir, "editor")
+	script := `#!/bin/sh
+if grep -q 'already exists' "$1"; then
+	exit 0
+elif grep -q '^#! ' "$1"; then
+	printf 'Spell: ls -la\nName: <name>\n' > "$1"
+else
+	printf 'Spel: ls -la\nName: <name>\n' > "$1"
+fi
+`
+
+	var testCases = []struct {
+		name    string
+		newName string
+
+		want spellRef
+		err  error
+	}{
+		{
+			name:    "same name",
+			newName: "ls",
+
+			want: spellRef{Name: "tools/ls"},
+		},
+		{
+			name:    "renamed",
+			newName: "list",
+
+			want: spellRef{Name: "tools/list"},
+		},
+		{
+			name:    "renamed over another spell",
+			newName: "other",
+
+			want: spellRef{Name: "tools/ls"},
+			err:  fmt.Errorf("spell tools/ls not saved: spell tools/other already exists"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := Grimoire{Name: "local", Path: t.TempDir()}
+			for _, name := range []string{"ls", "other"} {
+				if err := writeSpell(filepath.Join(g.Path, "tools"), Entry{Spell: "ls", Name: name}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s := strings.ReplaceAll(script, "<name>", tc.newName)
+			if err := os.WriteFile(editor, []byte(s), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			ref := spellRef{Name: "tools/ls", Grimoire: g}
+			got, err := editSpell(editor, ref)
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+
+			tc.want.Grimoire = g
+			if got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+
+			entry, err := readSpellRef(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.err == nil && entry.Spell != "ls -la" {
+				t.Errorf("got spell %q, want the edited spell", entry.Spell)
+			}
+
+			// Nothing is left behind besides the spells themselves
+			files, err := os.ReadDir(filepath.Join(g.Path, "tools"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 2 {
+				t.Errorf("got %d files, want 2", len(files))
+			}
+		})
+	}
+}
+
+func TestEditSpellNamedApart(t *testing.T) {
+	g := Grimoire{Name: "local", Path: t.TempDir()}
+
+	// A spell written by hand, whose file isn't named after it
+	ref := spellRef{Name: "ls", Grimoire: g}
+	if err := os.WriteFile(ref.Path(), []byte("Spell: ls\nName: list-files\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	editor := filepath.Join(t.TempDir(), "editor")
+	script := "#!/bin/sh\nprintf 'Spell: ls -la\\nName: list-files\\n' > \"$1\"\n"
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := editSpell(editor, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != ref {
+		t.Errorf("got %v, want the spell left at %v", got, ref)
+	}
+
+	entry, err := readSpellRef(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Spell != "ls -la" {
+		t.Errorf("got spell %q, want the edited spell", entry.Spell)
+	}
+}
+
+func TestEditSpellWithoutName(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		original string
+		edited   string
+
+		want spellRef
+	}{
+		{
+			name:     "still without a name",
+			original: "Spell: ls\n",
+			edited:   "Spell: ls -la\nDescription: list everything\n",
+
+			want: spellRef{Name: "ls"},
+		},
+		{
+			name:     "named after its file",
+			original: "Spell: ls\n",
+			edited:   "Spell: ls -la\nName: ls\n",
+
+			want: spellRef{Name: "ls"},
+		},
+		{
+			name:     "named otherwise",
+			original: "Spell: ls\n",
+			edited:   "Spell: ls -la\nName: list\n",
+
+			want: spellRef{Name: "list"},
+		},
+		{
+			name:     "name removed",
+			original: "Spell: ls\nName: list-files\n",
+			edited:   "Spell: ls -la\n",
+
+			want: spellRef{Name: "ls"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := Grimoire{Name: "local", Path: t.TempDir()}
+			ref := spellRef{Name: "ls", Grimoire: g}
+			if err := os.WriteFile(ref.Path(), []byte(tc.original), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			edited := filepath.Join(t.TempDir(), "edited")
+			if err := os.WriteFile(edited, []byte(tc.edited), 0644); err != nil {
+				t.Fatal(err)
+			}
+			editor := filepath.Join(t.TempDir(), "editor")
+			if err := os.WriteFile(editor, []byte("#!/bin/sh\ncp "+edited+" \"$1\"\n"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := editSpell(editor, ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tc.want.Grimoire = g
+			if got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+
+			contents, err := os.ReadFile(got.Path())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(contents) != tc.edited {
+				t.Errorf("got spell %q, want %q", contents, tc.edited)
+			}
+		})
+	}
+}
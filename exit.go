@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Exit codes for grimoire's own failures. When a spell is cast, grimoire exits
+// with the spell's exit code instead, or 128 plus the signal number if the
+// spell was killed by a signal.
+const (
+	exitFailure   = 1   // Any other error
+	exitUsage     = 2   // Invalid command line arguments or flags
+	exitNotFound  = 3   // The spell, or another file it needs, doesn't exist
+	exitParse     = 4   // A spell or config file couldn't be parsed
+	exitCancelled = 130 // The user cancelled a selection or prompt
+)
+
+// errCancelled is returned when the user backs out of a selection or prompt.
+var errCancelled = errors.New("cancelled")
+
+// exitError is an error that causes grimoire to exit with a particular code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func usageErrorf(format string, args ...any) error {
+	return &exitError{code: exitUsage, err: fmt.Errorf(format, args...)}
+}
+
+func parseErrorf(format string, args ...any) error {
+	return &exitError{code: exitParse, err: fmt.Errorf(format, args...)}
+}
+
+// spellFailedError reports that a cast spell exited unsuccessfully, which
+// grimoire passes on as its own exit code.
+type spellFailedError struct {
+	code int
+}
+
+func (e *spellFailedError) Error() string {
+	return fmt.Sprintf("spell exited with status %d", e.code)
+}
+
+// exitCode returns the code that grimoire should exit with after err.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var failed *spellFailedError
+	if errors.As(err, &failed) {
+		return failed.code
+	}
+
+	var exit *exitError
+	if errors.As(err, &exit) {
+		return exit.code
+	}
+
+	if errors.Is(err, errCancelled) {
+		return exitCancelled
+	}
+
+	if errors.Is(err, os.ErrNotExist) {
+		return exitNotFound
+	}
+
+	return exitFailure
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// exported is a spell being exported, along with where it was found.
+type exported struct {
+	Ref   spellRef
+	Entry Entry
+	// Params are the parameters used anywhere in the spell, as parsed by
+	// ParseSpell.
+	Params []Param
+}
+
+// Name returns the name of the spell within its book.
+func (e exported) Name() string {
+	return path.Base(e.Ref.Name)
+}
+
+// exporters maps each format spells can be exported to onto the function that
+// writes them.
+var exporters = map[string]func(w io.Writer, spells []exported, groupBy string) error{
+	"markdown": exportMarkdown,
+	"json":     exportJSON,
+	"pet":      exportPet,
+	"navi":     exportNavi,
+}
+
+// exportedParam and exportedStep are how parameters and runbook steps are
+// written in JSON.
+type exportedParam struct {
+	Name     string   `json:"name"`
+	Defaults []string `json:"defaults,omitempty"`
+}
+
+type exportedStep struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+}
+
+// exportedSpell is how a spell is written in JSON.
+type exportedSpell struct {
+	Name        string          `json:"name"`
+	Book        string          `json:"book,omitempty"`
+	Grimoire    string          `json:"grimoire"`
+	Description string          `json:"description,omitempty"`
+	Spell       string          `json:"spell,omitempty"`
+	Steps       []exportedStep  `json:"steps,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	Params      []exportedParam `json:"params,omitempty"`
+	Interpreter string          `json:"interpreter,omitempty"`
+	Dir         string          `json:"dir,omitempty"`
+	Env         []string        `json:"env,omitempty"`
+	Timeout     string          `json:"timeout,omitempty"`
+}
+
+func exportJSON(w io.Writer, spells []exported, groupBy string) error {
+	out := make([]exportedSpell, 0, len(spells))
+	for _, spell := range spells {
+		e := exportedSpell{
+			Name:        spell.Name(),
+			Book:        spell.Ref.Book(),
+			Grimoire:    spell.Ref.Grimoire.Name,
+			Description: spell.Entry.Desc,
+			Spell:       spell.Entry.Spell,
+			Tags:        spell.Entry.Tags,
+			Interpreter: spell.Entry.Interpreter,
+			Dir:         spell.Entry.Dir,
+			Env:         spell.Entry.Env,
+		}
+		if spell.Entry.Timeout > 0 {
+			e.Timeout = spell.Entry.Timeout.String()
+		}
+		for _, step := range spell.Entry.Steps {
+			e.Steps = append(e.Steps, exportedStep{Name: step.Name, Command: step.Command})
+		}
+		for _, param := range spell.Params {
+			e.Params = append(e.Params, exportedParam{Name: param.Name, Defaults: param.DefaultValues})
+		}
+		out = append(out, e)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(out)
+}
+
+// exportGroups groups spells by book or by tag for Markdown, sorted by name
+// with the group of spells in no book or with no tags last. A spell with
+// several tags is in the group for each.
+func exportGroups(spells []exported, groupBy string) ([]string, map[string][]exported) {
+	groups := make(map[string][]exported)
+	for _, spell := range spells {
+		keys := []string{spell.Ref.Book()}
+		if groupBy == "tag" {
+			keys = spell.Entry.Tags
+			if len(keys) == 0 {
+				keys = []string{""}
+			}
+		}
+		for _, key := range keys {
+			groups[key] = append(groups[key], spell)
+		}
+	}
+
+	var names []string
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == "" || names[j] == "" {
+			return names[j] == ""
+		}
+		return names[i] < names[j]
+	})
+
+	return names, groups
+}
+
+// markdownCell escapes text to be put in a cell of a Markdown table.
+func markdownCell(text string) string {
+	return strings.ReplaceAll(text, "|", `\|`)
+}
+
+// exportMarkdown writes spells as a cheatsheet with a section for each book or
+// tag, documenting each spell's parameters.
+func exportMarkdown(w io.Writer, spells []exported, groupBy string) error {
+	fmt.Fprintln(w, "# Grimoire")
+
+	names, groups := exportGroups(spells, groupBy)
+	for _, name := range names {
+		heading := name
+		if heading == "" && groupBy == "tag" {
+			heading = "Untagged"
+		} else if heading == "" {
+			heading = "Unsorted"
+		}
+		fmt.Fprintf(w, "\n## %s\n", heading)
+
+		for _, spell := range groups[name] {
+			fmt.Fprintf(w, "\n### %s\n", spell.Name())
+
+			if spell.Entry.Desc != "" {
+				fmt.Fprintf(w, "\n%s\n", spell.Entry.Desc)
+			}
+
+			if spell.Entry.Spell != "" {
+				fmt.Fprintf(w, "\n```sh\n%s\n```\n", spell.Entry.Spell)
+			}
+
+			if len(spell.Entry.Steps) > 0 {
+				fmt.Fprintln(w)
+				for i, step := range spell.Entry.Steps {
+					if step.Name == "" {
+						fmt.Fprintf(w, "%d. `%s`\n", i+1, step.Command)
+					} else {
+						fmt.Fprintf(w, "%d. %s: `%s`\n", i+1, step.Name, step.Command)
+					}
+				}
+			}
+
+			if len(spell.Params) > 0 {
+				fmt.Fprintf(w, "\n| Parameter | Default | Alternatives |\n|-----------|---------|--------------|\n")
+				for _, param := range spell.Params {
+					def, alternatives := "", ""
+					if len(param.DefaultValues) > 0 {
+						def = "`" + markdownCell(param.DefaultValues[0]) + "`"
+					}
+					for _, value := range param.DefaultValues[min(1, len(param.DefaultValues)):] {
+						if alternatives != "" {
+							alternatives += ", "
+						}
+						alternatives += "`" + markdownCell(value) + "`"
+					}
+					fmt.Fprintf(w, "| `%s` | %s | %s |\n", markdownCell(param.Name), def, alternatives)
+				}
+			}
+
+			if len(spell.Entry.Tags) > 0 && groupBy != "tag" {
+				fmt.Fprintf(w, "\nTags: %s\n", strings.Join(spell.Entry.Tags, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// rewriteParams rewrites each parameter in a spell with the text returned by
+// rewrite, given the parameter's name and defaults.
+func rewriteParams(spell string, rewrite func(name string, defaults []string) string) string {
+	return paramRegex.ReplaceAllStringFunc(spell, func(param string) string {
+		name, defaults := extractParamNameAndDefaults(param, 1, len(param)-1)
+		return rewrite(name, defaults)
+	})
+}
+
+// quoteTOML quotes s as a TOML basic string.
+func quoteTOML(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// exportPet writes spells as a pet snippet file. Defaults with alternatives
+// become pet's choices, written as <param=|_a_||_b_|>.
+func exportPet(w io.Writer, spells []exported, groupBy string) error {
+	for i, spell := range spells {
+		command := rewriteParams(spell.Entry.Spell, func(name string, defaults []string) string {
+			switch len(defaults) {
+			case 0:
+				return "<" + name + ">"
+			case 1:
+				return "<" + name + "=" + defaults[0] + ">"
+			default:
+				return "<" + name + "=|_" + strings.Join(defaults, "_||_") + "_|>"
+			}
+		})
+
+		desc := spell.Entry.Desc
+		if desc == "" {
+			desc = spell.Name()
+		}
+
+		tags := make([]string, len(spell.Entry.Tags))
+		for i, tag := range spell.Entry.Tags {
+			tags[i] = quoteTOML(tag)
+		}
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "[[snippets]]")
+		fmt.Fprintf(w, "  description = %s\n", quoteTOML(desc))
+		fmt.Fprintf(w, "  command = %s\n", quoteTOML(command))
+		fmt.Fprintf(w, "  tag = [%s]\n", strings.Join(tags, ", "))
+		fmt.Fprintf(w, "  output = \"\"\n")
+	}
+
+	return nil
+}
+
+// naviVariable matches the characters navi doesn't allow in variable names.
+var naviVariable = regexp.MustCompile(`[^\w-]`)
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// exportNavi writes spells as a navi cheatsheet. Each spell has its own
+// section so that the suggestions made for its defaults don't apply to any
+// other spell.
+func exportNavi(w io.Writer, spells []exported, groupBy string) error {
+	for i, spell := range spells {
+		var suggestions []string
+		command := rewriteParams(spell.Entry.Spell, func(name string, defaults []string) string {
+			variable := naviVariable.ReplaceAllString(name, "_")
+			if len(defaults) > 0 {
+				quoted := make([]string, len(defaults))
+				for i, value := range defaults {
+					quoted[i] = shellQuote(value)
+				}
+				suggestion := fmt.Sprintf("$ %s: printf '%%s\\n' %s", variable, strings.Join(quoted, " "))
+				if !slices.Contains(suggestions, suggestion) {
+					suggestions = append(suggestions, suggestion)
+				}
+			}
+			return "<" + variable + ">"
+		})
+
+		tags := slices.Clone(spell.Entry.Tags)
+		if len(tags) == 0 {
+			tags = []string{"grimoire"}
+		}
+
+		desc := spell.Entry.Desc
+		if desc == "" {
+			desc = spell.Name()
+		}
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%% %s\n\n", strings.Join(tags, ", "))
+		fmt.Fprintf(w, "# %s\n%s\n", desc, command)
+		if len(suggestions) > 0 {
+			fmt.Fprintf(w, "\n%s\n", strings.Join(suggestions, "\n"))
+		}
+	}
+
+	return nil
+}
+
+// exportCommand writes spells to stdout in a format for reading or for other
+// tools, optionally only those in a book or with a tag.
+func exportCommand(conf Config, args []string) error {
+	var format, book, tag, groupBy string
+	flagSet := flag.NewFlagSet("export", flag.ExitOnError)
+	flagSet.StringVar(&format, "format", "markdown", "The format to export to: markdown, json, pet or navi")
+	flagSet.StringVar(&book, "b", "", "Only export spells in the given book, such as k8s")
+	flagSet.StringVar(&tag, "t", "", "Only export spells with the given tag")
+	flagSet.StringVar(&groupBy, "group", "book", "Group Markdown by book or by tag")
+	flagSet.Parse(args)
+
+	if flagSet.NArg() > 0 {
+		return usageErrorf("too many arguments")
+	}
+
+	write, ok := exporters[format]
+	if !ok {
+		return usageErrorf("--format: expected one of markdown, json, pet or navi, got %q", format)
+	}
+
+	if groupBy != "book" && groupBy != "tag" {
+		return usageErrorf("--group: expected book or tag, got %q", groupBy)
+	}
+
+	if err := checkBook(book); err != nil {
+		return usageErrorf("%v", err)
+	}
+
+	refs, err := listGrimoires(conf.Grimoires)
+	if err != nil {
+		return err
+	}
+
+	var spells []exported
+	for _, ref := range inBook(refs, book) {
+		entry, err := readSpellRef(ref)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", ref.Path(), err)
+			continue
+		}
+
+		if tag != "" && !slices.Contains(entry.Tags, tag) {
+			continue
+		}
+
+		// pet and navi snippets are single commands
+		if len(entry.Steps) > 0 && (format == "pet" || format == "navi") {
+			fmt.Fprintf(os.Stderr, "Warning: skipping runbook %s, %s has no equivalent\n", ref.Name, format)
+			continue
+		}
+
+		t, err := parseTemplate(entry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", ref.Path(), err)
+			continue
+		}
+
+		params, err := t.Params()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", ref.Path(), err)
+			continue
+		}
+
+		spells = append(spells, exported{Ref: ref, Entry: entry, Params: params})
+	}
+
+	return write(os.Stdout, spells, groupBy)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+// exportFixture returns spells to export, with their parameters parsed.
+func exportFixture(t *testing.T) []exported {
+	t.Helper()
+
+	g := Grimoire{Name: "grimoire", Path: "/home/me/grimoire"}
+	entries := []struct {
+		name  string
+		entry Entry
+	}{
+		{"k8s/pods", Entry{Spell: "kubectl get pods -n <namespace=default;kube-system> | grep '<filter>'", Name: "pods", Desc: "List pods", Tags: []string{"k8s"}}},
+		{"ping", Entry{Spell: `ping -c <count=3> "<host>"`, Name: "ping", Tags: []string{"network", "debug"}}},
+	}
+
+	var spells []exported
+	for _, e := range entries {
+		tmpl, err := parseTemplate(e.entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params, err := tmpl.Params()
+		if err != nil {
+			t.Fatal(err)
+		}
+		spells = append(spells, exported{Ref: spellRef{Name: e.name, Grimoire: g}, Entry: e.entry, Params: params})
+	}
+
+	return spells
+}
+
+func TestExportPet(t *testing.T) {
+	var b bytes.Buffer
+	if err := exportPet(&b, exportFixture(t), "book"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Importing what was exported should give back the same spells
+	result, _, err := importPet("snippet.toml", b.String())
+	if err != nil {
+		t.Fatalf("%v in:\n%s", err, b.String())
+	}
+
+	want := []Entry{
+		{Spell: "kubectl get pods -n <namespace=default;kube-system> | grep '<filter>'", Name: "list_pods", Desc: "List pods", Tags: []string{"k8s"}},
+		{Spell: `ping -c <count=3> "<host>"`, Name: "ping", Desc: "ping", Tags: []string{"network", "debug"}},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, want, test.Diff(result, want))
+	}
+}
+
+func TestExportNavi(t *testing.T) {
+	var b bytes.Buffer
+	if err := exportNavi(&b, exportFixture(t), "book"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `% k8s
+
+# List pods
+kubectl get pods -n <namespace> | grep '<filter>'
+
+$ namespace: printf '%s\n' 'default' 'kube-system'
+
+% network, debug
+
+# ping
+ping -c <count> "<host>"
+
+$ count: printf '%s\n' '3'
+`
+	if b.String() != want {
+		t.Errorf("unexpected result\ngot: %s\nwant:%s\ndiff: %s", b.String(), want, test.Diff(b.String(), want))
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		groupBy string
+
+		want string
+	}{
+		{
+			name:    "by book",
+			groupBy: "book",
+
+			want: "# Grimoire\n" +
+				"\n## k8s\n" +
+				"\n### pods\n" +
+				"\nList pods\n" +
+				"\n```sh\nkubectl get pods -n <namespace=default;kube-system> | grep '<filter>'\n```\n" +
+				"\n| Parameter | Default | Alternatives |\n|-----------|---------|--------------|\n" +
+				"| `namespace` | `default` | `kube-system` |\n" +
+				"| `filter` |  |  |\n" +
+				"\nTags: k8s\n" +
+				"\n## Unsorted\n" +
+				"\n### ping\n" +
+				"\n```sh\nping -c <count=3> \"<host>\"\n```\n" +
+				"\n| Parameter | Default | Alternatives |\n|-----------|---------|--------------|\n" +
+				"| `count` | `3` |  |\n" +
+				"| `host` |  |  |\n" +
+				"\nTags: network, debug\n",
+		},
+		{
+			name:    "by tag",
+			groupBy: "tag",
+
+			want: "# Grimoire\n" +
+				"\n## debug\n" +
+				"\n### ping\n" +
+				"\n```sh\nping -c <count=3> \"<host>\"\n```\n" +
+				"\n| Parameter | Default | Alternatives |\n|-----------|---------|--------------|\n" +
+				"| `count` | `3` |  |\n" +
+				"| `host` |  |  |\n" +
+				"\n## k8s\n" +
+				"\n### pods\n" +
+				"\nList pods\n" +
+				"\n```sh\nkubectl get pods -n <namespace=default;kube-system> | grep '<filter>'\n```\n" +
+				"\n| Parameter | Default | Alternatives |\n|-----------|---------|--------------|\n" +
+				"| `namespace` | `default` | `kube-system` |\n" +
+				"| `filter` |  |  |\n" +
+				"\n## network\n" +
+				"\n### ping\n" +
+				"\n```sh\nping -c <count=3> \"<host>\"\n```\n" +
+				"\n| Parameter | Default | Alternatives |\n|-----------|---------|--------------|\n" +
+				"| `count` | `3` |  |\n" +
+				"| `host` |  |  |\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := exportMarkdown(&b, exportFixture(t), tc.groupBy); err != nil {
+				t.Fatal(err)
+			}
+
+			if b.String() != tc.want {
+				t.Errorf("unexpected result\ngot: %s\nwant:%s\ndiff: %s", b.String(), tc.want, test.Diff(b.String(), tc.want))
+			}
+		})
+	}
+}
+
+func TestExportMarkdownRunbook(t *testing.T) {
+	entry := Entry{
+		Name: "upgrade",
+		Steps: []Step{
+			{Name: "drain", Command: "kubectl drain <node>"},
+			{Command: "ssh <node> sudo apt upgrade"},
+		},
+	}
+	spells := []exported{{Ref: spellRef{Name: "upgrade", Grimoire: Grimoire{Name: "grimoire"}}, Entry: entry}}
+
+	want := "# Grimoire\n" +
+		"\n## Unsorted\n" +
+		"\n### upgrade\n" +
+		"\n1. drain: `kubectl drain <node>`\n" +
+		"2. `ssh <node> sudo apt upgrade`\n"
+
+	var b bytes.Buffer
+	if err := exportMarkdown(&b, spells, "book"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != want {
+		t.Errorf("unexpected result\ngot: %s\nwant:%s\ndiff: %s", b.String(), want, test.Diff(b.String(), want))
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := exportJSON(&b, exportFixture(t), "book"); err != nil {
+		t.Fatal(err)
+	}
+
+	var result []exportedSpell
+	if err := json.Unmarshal(b.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	want := exportedSpell{
+		Name:        "pods",
+		Book:        "k8s",
+		Grimoire:    "grimoire",
+		Description: "List pods",
+		Spell:       "kubectl get pods -n <namespace=default;kube-system> | grep '<filter>'",
+		Tags:        []string{"k8s"},
+		Params:      []exportedParam{{Name: "namespace", Defaults: []string{"default", "kube-system"}}, {Name: "filter"}},
+	}
+	if len(result) != 2 || !reflect.DeepEqual(result[0], want) {
+		t.Errorf("unexpected result\ngot: %#v\nwant:%#v", result, want)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultJobs is how many fanned out casts run at once unless configured.
+const defaultJobs = 8
+
+// parseEach parses the param=values argument of --each. Values are comma
+// delimited, or read one per line from a file with @path, or from stdin
+// with -.
+func parseEach(each string, stdin io.Reader) (string, []string, error) {
+	name, list, ok := strings.Cut(each, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", nil, usageErrorf("--each: expected param=values, got %s", each)
+	}
+
+	var values []string
+	switch {
+	case list == "-" || strings.HasPrefix(list, "@"):
+		r := stdin
+		if list != "-" {
+			file, err := os.Open(strings.TrimPrefix(list, "@"))
+			if err != nil {
+				return "", nil, err
+			}
+			defer file.Close()
+			r = file
+		}
+
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if value := strings.TrimSpace(scanner.Text()); value != "" {
+				values = append(values, value)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return "", nil, err
+		}
+	default:
+		values = splitList(list)
+	}
+
+	if len(values) == 0 {
+		return "", nil, usageErrorf("--each: no values given for %s", name)
+	}
+
+	return name, values, nil
+}
+
+// prefixWriter writes each complete line written to it to out, prefixed with
+// prefix. Writers sharing a mutex never interleave their lines.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush writes out any final line that wasn't terminated by a newline.
+func (w *prefixWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	err := w.writeLine(append(w.buf, '\n'))
+	w.buf = nil
+	return err
+}
+
+func (w *prefixWriter) writeLine(line []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err := fmt.Fprintf(w.out, "%s%s", w.prefix, line)
+	return err
+}
+
+// fanOutIncantations prepares one incantation for each value of the named
+// parameter. Any other parameters are only prompted for once.
+func fanOutIncantations(conf Config, entry Entry, preset map[string]string, name string, values []string) ([]*Incantation, error) {
+	preset = maps.Clone(preset)
+	if preset == nil {
+		preset = make(map[string]string)
+	}
+	preset[name] = values[0]
+
+	t, resolved, err := resolveParams(conf, entry, preset)
+	if err != nil {
+		return nil, err
+	}
+
+	var incs []*Incantation
+	for _, value := range values {
+		params := maps.Clone(resolved)
+		params[name] = value
+
+		inc, err := t.Incantation(conf, entry, params)
+		if err != nil {
+			return nil, err
+		}
+		incs = append(incs, inc)
+	}
+
+	return incs, nil
+}
+
+// confirmFanOut shows every command that is about to be cast and, if the spell
+// or config asks for it and yes isn't set, lets the user cancel them. If any
+// command is dangerous, the spell's name must be typed out even with yes set.
+func confirmFanOut(conf Config, entry Entry, incs []*Incantation, yes bool) error {
+	for _, inc := range incs {
+		fmt.Printf("%s\n", inc.Command)
+	}
+
+	if !yes && (conf.Confirm || entry.Confirm) {
+		action, err := promptWithTabCycling([]string{"cast", "cancel"})
+		if err != nil {
+			return err
+		}
+		if action != "cast" {
+			fmt.Println("Spell cancelled")
+			return errCancelled
+		}
+	}
+
+	for _, inc := range incs {
+		matches := checkDanger(conf.DangerRules, inc.Command, entry.Allow)
+		if len(matches) == 0 {
+			continue
+		}
+
+		// One confirmation covers every command
+		ok, err := confirmDanger(inc.Name, inc.Command, matches)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Spell cancelled")
+			return errCancelled
+		}
+		break
+	}
+
+	return nil
+}
+
+// castFanOut casts every incantation with at most jobs running at once. Each
+// line of output is prefixed with the value of the fanned out parameter, and
+// the exit code of each cast is summarized once they have all finished.
+func castFanOut(conf Config, name string, incs []*Incantation, jobs int) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	width := 0
+	for _, inc := range incs {
+		width = max(width, len(inc.Params[name]))
+	}
+
+	codes := make([]int, len(incs))
+	errs := make([]error, len(incs))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, jobs)
+
+	start := time.Now()
+	for i, inc := range incs {
+		// Wait for a free slot first so that casts start in order
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			cmd, err := incantationCommand(inc)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			prefix := fmt.Sprintf("[%-*s] ", width, inc.Params[name])
+			stdout := &prefixWriter{mu: &mu, out: os.Stdout, prefix: prefix}
+			stderr := &prefixWriter{mu: &mu, out: os.Stderr, prefix: prefix}
+
+			// Casts running side by side can't share the terminal's stdin
+			if cmd.Stdin == os.Stdin {
+				cmd.Stdin = nil
+			}
+			cmd.Stdout = stdout
+			cmd.Stderr = stderr
+
+			codes[i], _, _, errs[i] = runHooked(conf, inc, cmd)
+			stdout.Flush()
+			stderr.Flush()
+		}()
+	}
+
+	wg.Wait()
+	duration := time.Since(start)
+
+	var failed error
+	fmt.Fprintln(os.Stderr, "Summary:")
+	for i, inc := range incs {
+		value := inc.Params[name]
+		switch {
+		case errs[i] != nil:
+			fmt.Fprintf(os.Stderr, "  %-*s  fizzled: %v\n", width, value, errs[i])
+			if failed == nil {
+				failed = &spellFailedError{code: exitFailure}
+			}
+		case codes[i] != 0:
+			fmt.Fprintf(os.Stderr, "  %-*s  exit %d\n", width, value, codes[i])
+			if failed == nil {
+				failed = &spellFailedError{code: codes[i]}
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "  %-*s  ok\n", width, value)
+		}
+	}
+
+	code := 0
+	if failed != nil {
+		code = exitCode(failed)
+	}
+	notifyCast(conf, &Incantation{Name: incs[0].Name}, code, duration)
+
+	return failed
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestParseEach(t *testing.T) {
+	dir := t.TempDir()
+	hostsPath := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(hostsPath, []byte("web-1\n\n  web-2  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name  string
+		each  string
+		stdin string
+
+		wantName   string
+		wantValues []string
+		err        error
+	}{
+		{
+			name: "ok - comma delimited",
+			each: "host=a, b,c",
+
+			wantName:   "host",
+			wantValues: []string{"a", "b", "c"},
+		},
+		{
+			name: "ok - from file",
+			each: "host=@" + hostsPath,
+
+			wantName:   "host",
+			wantValues: []string{"web-1", "web-2"},
+		},
+		{
+			name:  "ok - from stdin",
+			each:  "namespace=-",
+			stdin: "default\nkube-system\n",
+
+			wantName:   "namespace",
+			wantValues: []string{"default", "kube-system"},
+		},
+		{
+			name: "error - missing values",
+			each: "host",
+
+			err: fmt.Errorf("--each: expected param=values, got host"),
+		},
+		{
+			name: "error - no values",
+			each: "host=,",
+
+			err: fmt.Errorf("--each: no values given for host"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name, values, err := parseEach(tc.each, strings.NewReader(tc.stdin))
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if name != tc.wantName {
+				t.Errorf("got name '%s', want '%s'", name, tc.wantName)
+			}
+			if !reflect.DeepEqual(values, tc.wantValues) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", values, tc.wantValues, test.Diff(values, tc.wantValues))
+			}
+		})
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out strings.Builder
+	w := &prefixWriter{mu: &sync.Mutex{}, out: &out, prefix: "[a] "}
+
+	fmt.Fprint(w, "one\ntw")
+	fmt.Fprint(w, "o\nthree")
+	w.Flush()
+
+	want := "[a] one\n[a] two\n[a] three\n"
+	if got := out.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
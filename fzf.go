@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
@@ -17,29 +18,68 @@ func checkFzf() error {
 	return nil
 }
 
-func find(dir string) (string, error) {
-	cmd := exec.Command("fzf")
+// findSpell lets the user pick one of the spells in a book of the grimoires
+// with fzf, showing which grimoire each is from when there is more than one.
+// It returns false if nothing was selected.
+func findSpell(grimoires []Grimoire, book string) (spellRef, bool, error) {
+	refs, err := listGrimoires(grimoires)
+	if err != nil {
+		return spellRef{}, false, err
+	}
+	refs = inBook(refs, book)
+
+	width := 0
+	for _, ref := range refs {
+		width = max(width, len(ref.Name))
+	}
 
-	cmd.Dir = dir
+	lines := make([]string, len(refs))
+	for i, ref := range refs {
+		lines[i] = ref.Name
+		if len(grimoires) > 1 {
+			lines[i] = fmt.Sprintf("%-*s  %s", width, ref.Name, ref.Grimoire.Name)
+		}
+	}
+
+	i, err := findLine(lines)
+	if err != nil || i < 0 {
+		return spellRef{}, false, err
+	}
 
-	// Connect stdin and stderr for interactive use, but capture stdout
-	// so that we can get the selected file for further processing
-	cmd.Stdin = os.Stdin
+	return refs[i], true, nil
+}
+
+// findLine lets the user pick one of lines with fzf, returning the index of the
+// selected line or -1 if nothing was selected.
+func findLine(lines []string) (int, error) {
+	// Prefix each line with its index, hidden from the user, so that the
+	// selection can be mapped back to it even if lines are repeated.
+	var input strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&input, "%d\t%s\n", i, strings.ReplaceAll(line, "\n", " "))
+	}
+
+	cmd := exec.Command("fzf", "--no-sort", "--delimiter", "\t", "--with-nth", "2..")
+	cmd.Stdin = strings.NewReader(input.String())
 	cmd.Stderr = os.Stderr
 
-	// Capture the selection
 	output, err := cmd.Output()
-
 	if err != nil {
-		// fzf returns exit code 1 when user cancels (Ctrl+C), which is normal
+		// fzf returns exit code 1 when there is no match and 130 when the
+		// user cancels, both of which mean nothing was selected
 		if exitError, ok := err.(*exec.ExitError); ok {
-			if exitError.ExitCode() == 1 {
-				return "", nil
+			if exitError.ExitCode() == 1 || exitError.ExitCode() == 130 {
+				return -1, nil
 			}
-		} else {
-			return "", fmt.Errorf("running fzf: %w", err)
 		}
+		return -1, fmt.Errorf("running fzf: %w", err)
+	}
+
+	index, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\t")
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 0 || i >= len(lines) {
+		return -1, fmt.Errorf("unexpected selection from fzf: %s", output)
 	}
 
-	return strings.TrimSpace(string(output)), nil
+	return i, nil
 }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultGitRemote is the remote that `grimoire sync` pulls from and pushes to
+// when no GitRemote setting is given.
+const defaultGitRemote = "origin"
+
+// gitCommand returns the command that runs git in dir.
+func gitCommand(dir string, args ...string) *exec.Cmd {
+	return exec.Command("git", append([]string{"-C", dir}, args...)...)
+}
+
+// git runs git in dir, returning its trimmed output. A failing git command
+// results in an error that includes what git printed.
+func git(dir string, args ...string) (string, error) {
+	cmd := gitCommand(dir, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// isGitRepo reports whether dir is the top of a git repository.
+func isGitRepo(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// commitSpells commits any changes to the given spell files, relative to
+// spellPath, creating the repository first if it doesn't exist yet. Nothing is
+// committed if the files haven't changed.
+func commitSpells(spellPath, message string, names ...string) error {
+	if !isGitRepo(spellPath) {
+		if _, err := git(spellPath, "init", "--quiet"); err != nil {
+			return err
+		}
+	}
+
+	paths := append([]string{"--"}, names...)
+
+	if _, err := git(spellPath, append([]string{"add", "--all"}, paths...)...); err != nil {
+		return err
+	}
+
+	// diff --quiet exits with 1 when there are staged changes to commit
+	_, err := git(spellPath, append([]string{"diff", "--cached", "--quiet"}, paths...)...)
+	if err == nil {
+		return nil
+	}
+
+	_, err = git(spellPath, append([]string{"commit", "--quiet", "--message", message}, paths...)...)
+	return err
+}
+
+// autoCommit commits changes to spells in a grimoire when grimoires are kept
+// in git. A project's spells are left for the project's own repository. The
+// spells have already been saved by then, so failing to commit is only a
+// warning.
+func autoCommit(conf Config, g Grimoire, message string, names ...string) {
+	if !conf.Git || g.Root != "" {
+		return
+	}
+
+	if err := commitSpells(g.Path, message, names...); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: spells saved but not committed: %v\n", err)
+	}
+}
+
+// syncSpells commits any outstanding changes to the spells, then rebases them
+// onto the remote's copy of the current branch and pushes them back.
+func syncSpells(spellPath, remote string) error {
+	if !isGitRepo(spellPath) {
+		return fmt.Errorf("%s is not a git repository, set Git: yes to keep spells in git", spellPath)
+	}
+
+	if err := commitSpells(spellPath, "Sync spells", "."); err != nil {
+		return err
+	}
+
+	// symbolic-ref works even before the first commit, unlike rev-parse
+	branch, err := git(spellPath, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return err
+	}
+
+	onRemote, err := remoteHasBranch(spellPath, remote, branch)
+	if err != nil {
+		return err
+	}
+
+	// A new remote has nothing to pull yet
+	if onRemote {
+		if _, err := git(spellPath, "pull", "--quiet", "--rebase", remote, branch); err != nil {
+			return err
+		}
+	}
+
+	_, err = git(spellPath, "push", "--quiet", "--set-upstream", remote, branch)
+	return err
+}
+
+// remoteHasBranch reports whether the branch exists on the remote.
+func remoteHasBranch(dir, remote, branch string) (bool, error) {
+	cmd := gitCommand(dir, "ls-remote", "--quiet", "--exit-code", "--heads", remote, branch)
+	cmd.Stderr = os.Stderr
+
+	// ls-remote exits with 2 when the remote has no matching refs
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("git ls-remote: %w", err)
+	}
+
+	return true, nil
+}
+
+// syncCommand pulls spells from the configured remote and pushes local changes
+// back to it.
+func syncCommand(conf Config, args []string) error {
+	if len(args) > 0 {
+		return usageErrorf("too many arguments")
+	}
+
+	if conf.SpellPath == "" {
+		return errors.New("every grimoire is read-only, there is nothing to sync")
+	}
+
+	return syncSpells(conf.SpellPath, conf.GitRemote)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// setupGit skips the test if git isn't installed and gives it an identity to
+// commit with.
+func setupGit(t *testing.T) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "grimoire")
+	t.Setenv("GIT_AUTHOR_EMAIL", "grimoire@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "grimoire")
+	t.Setenv("GIT_COMMITTER_EMAIL", "grimoire@example.com")
+}
+
+func TestCommitSpells(t *testing.T) {
+	setupGit(t)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pods"), []byte("Spell: kubectl get pods\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := commitSpells(dir, "Add spell pods", "pods"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing has changed, so there is nothing more to commit
+	if err := commitSpells(dir, "Edit spell pods", "pods"); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := git(dir, "log", "--format=%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if log != "Add spell pods" {
+		t.Errorf("got log %q, want %q", log, "Add spell pods")
+	}
+}
+
+func TestSyncSpells(t *testing.T) {
+	setupGit(t)
+
+	remote := t.TempDir()
+	if _, err := git(remote, "init", "--quiet", "--bare"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each grimoire adds a spell and syncs, which should leave both with
+	// both spells.
+	first, second := t.TempDir(), t.TempDir()
+	for _, tc := range []struct{ dir, spell string }{{first, "pods"}, {second, "logs"}, {first, ""}} {
+		if !isGitRepo(tc.dir) {
+			if _, err := git(tc.dir, "init", "--quiet", "--initial-branch", "main"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := git(tc.dir, "remote", "add", "origin", remote); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if tc.spell != "" {
+			if err := os.WriteFile(filepath.Join(tc.dir, tc.spell), []byte("Spell: "+tc.spell+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := syncSpells(tc.dir, "origin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, dir := range []string{first, second} {
+		names, err := listSpells(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 2 {
+			t.Errorf("got spells %v in %s, want pods and logs", names, dir)
+		}
+	}
+}
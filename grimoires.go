@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// readOnlySuffix marks a SpellPath setting as read-only.
+const readOnlySuffix = "(read-only)"
+
+// Grimoire is one of the directories that spells are read from, such as a
+// personal grimoire or one shared by a team.
+type Grimoire struct {
+	// Name identifies the grimoire in the finder, in list output, and in
+	// qualified spell names such as team:pods.
+	Name string
+	Path string
+	// ReadOnly grimoires can be cast from but not edited or forgotten from.
+	ReadOnly bool
+	// Root is the root directory of the project that the grimoire belongs
+	// to, if any, which its spells are cast from.
+	Root string
+}
+
+// parseGrimoire parses a SpellPath setting, which is a path optionally
+// followed by (read-only). The grimoire is named after its directory.
+func parseGrimoire(value string) Grimoire {
+	path, readOnly := strings.CutSuffix(strings.TrimSpace(value), readOnlySuffix)
+	path = expandHome(strings.TrimSpace(path))
+
+	return Grimoire{
+		Name:     filepath.Base(path),
+		Path:     path,
+		ReadOnly: readOnly,
+	}
+}
+
+// uniqueGrimoireName returns name, or name with a number added if one of the
+// grimoires already has it, such as spells-2. Grimoires in different places
+// can have directories of the same name, but a qualified spell name must only
+// refer to one of them.
+func uniqueGrimoireName(grimoires []Grimoire, name string) string {
+	taken := func(name string) bool {
+		for _, g := range grimoires {
+			if g.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	unique := name
+	for n := 2; taken(unique); n++ {
+		unique = fmt.Sprintf("%s-%d", name, n)
+	}
+	return unique
+}
+
+// spellRef is a spell found in one of the grimoires.
+type spellRef struct {
+	Name     string
+	Grimoire Grimoire
+}
+
+// Path returns the path of the spell's file.
+func (r spellRef) Path() string {
+	return filepath.Join(r.Grimoire.Path, r.Name)
+}
+
+// String returns the spell's name qualified with its grimoire, which
+// lookupSpell resolves back to the same spell even if it is shadowed.
+func (r spellRef) String() string {
+	return r.Grimoire.Name + ":" + r.Name
+}
+
+// lookupSpell finds the named spell in the first grimoire that has it. A name
+// qualified with a grimoire, such as team:pods, is only looked for there. If a
+// book is given, the name is within that book.
+func lookupSpell(grimoires []Grimoire, book, name string) (spellRef, error) {
+	if prefix, rest, ok := strings.Cut(name, ":"); ok {
+		for _, g := range grimoires {
+			if g.Name == prefix {
+				grimoires = []Grimoire{g}
+				name = rest
+				break
+			}
+		}
+	}
+
+	name = path.Join(book, name)
+
+	for _, g := range grimoires {
+		ref := spellRef{Name: name, Grimoire: g}
+		if info, err := os.Stat(ref.Path()); err == nil && info.Mode().IsRegular() {
+			return ref, nil
+		}
+	}
+
+	return spellRef{}, &exitError{code: exitNotFound, err: fmt.Errorf("no spell named %s", name)}
+}
+
+// listGrimoires returns the spells in every grimoire. When grimoires have
+// spells of the same name, only the one from the earliest grimoire is
+// returned. A grimoire that doesn't exist, such as a shared one that hasn't
+// been cloned yet, has no spells.
+func listGrimoires(grimoires []Grimoire) ([]spellRef, error) {
+	var refs []spellRef
+	seen := make(map[string]bool)
+
+	for _, g := range grimoires {
+		names, err := listSpells(g.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			refs = append(refs, spellRef{Name: name, Grimoire: g})
+		}
+	}
+
+	return refs, nil
+}
+
+// checkWritable returns an error if the spell's grimoire is read-only, which
+// means the spell can't be changed in place.
+func checkWritable(ref spellRef, action string) error {
+	if ref.Grimoire.ReadOnly {
+		return fmt.Errorf("can't %s %s, grimoire %s is read-only", action, ref.Name, ref.Grimoire.Name)
+	}
+	return nil
+}
+
+// writableGrimoire returns the first grimoire that isn't read-only, which is
+// where new spells are added.
+func writableGrimoire(grimoires []Grimoire) (Grimoire, error) {
+	for _, g := range grimoires {
+		if !g.ReadOnly {
+			return g, nil
+		}
+	}
+	return Grimoire{}, errors.New("every grimoire is read-only, add a SpellPath that isn't")
+}
+
+// spellPathGrimoire returns the grimoire at conf.SpellPath, which new spells
+// are added to unless they are for a project.
+func spellPathGrimoire(conf Config) (Grimoire, error) {
+	for _, g := range conf.Grimoires {
+		if g.Path == conf.SpellPath && g.Root == "" {
+			return g, nil
+		}
+	}
+	return Grimoire{}, errors.New("every grimoire is read-only, add a SpellPath that isn't")
+}
+
+// copySpell copies the spell into another grimoire, so that it can be changed
+// there.
+func copySpell(ref spellRef, to Grimoire) (spellRef, error) {
+	contents, err := os.ReadFile(ref.Path())
+	if err != nil {
+		return ref, err
+	}
+
+	copied := spellRef{Name: ref.Name, Grimoire: to}
+	if _, err := os.Stat(copied.Path()); err == nil {
+		return ref, fmt.Errorf("spell %s already exists in grimoire %s", ref.Name, to.Name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(copied.Path()), 0755); err != nil {
+		return ref, err
+	}
+
+	if err := os.WriteFile(copied.Path(), contents, 0644); err != nil {
+		return ref, err
+	}
+
+	return copied, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"toddgaunt.com/grimoire/config"
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestParseGrimoire(t *testing.T) {
+	var testCases = []struct {
+		name  string
+		value string
+
+		want Grimoire
+	}{
+		{
+			name:  "writable",
+			value: "/home/me/grimoire",
+
+			want: Grimoire{Name: "grimoire", Path: "/home/me/grimoire"},
+		},
+		{
+			name:  "read-only",
+			value: "/srv/team-spells (read-only)",
+
+			want: Grimoire{Name: "team-spells", Path: "/srv/team-spells", ReadOnly: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := parseGrimoire(tc.value)
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+		})
+	}
+}
+
+func TestLookupSpellSameBaseName(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{"team-a/spells/pods", "team-b/spells/deploy"} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var conf Config
+	settings := config.Settings{"SpellPath": {filepath.Join(dir, "team-a/spells"), filepath.Join(dir, "team-b/spells")}}
+	if err := applySettings(&conf, settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every spell can be found again by its qualified name, as it is when
+	// picked from the finder
+	refs, err := listGrimoires(conf.Grimoires)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, ref := range refs {
+		found, err := lookupSpell(conf.Grimoires, "", ref.String())
+		if err != nil {
+			t.Fatalf("looking up %s: %v", ref, err)
+		}
+		if found != ref {
+			t.Errorf("looking up %s found %s", ref, found)
+		}
+		got = append(got, ref.String())
+	}
+
+	want := []string{"spells:pods", "spells-2:deploy"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", got, want, test.Diff(got, want))
+	}
+}
+
+// setupGrimoires creates a personal and a read-only team grimoire that both
+// have a pods spell.
+func setupGrimoires(t *testing.T) []Grimoire {
+	t.Helper()
+
+	dir := t.TempDir()
+	grimoires := []Grimoire{
+		{Name: "me", Path: filepath.Join(dir, "me")},
+		{Name: "team", Path: filepath.Join(dir, "team"), ReadOnly: true},
+		{Name: "missing", Path: filepath.Join(dir, "missing")},
+	}
+
+	for _, path := range []string{"me/pods", "me/logs", "me/k8s/restart", "team/pods", "team/deploy"} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return grimoires
+}
+
+func TestLookupSpell(t *testing.T) {
+	grimoires := setupGrimoires(t)
+
+	var testCases = []struct {
+		name  string
+		book  string
+		spell string
+
+		want string
+		err  error
+	}{
+		{
+			name:  "ok - earlier grimoire takes precedence",
+			spell: "pods",
+
+			want: "me:pods",
+		},
+		{
+			name:  "ok - only in a later grimoire",
+			spell: "deploy",
+
+			want: "team:deploy",
+		},
+		{
+			name:  "ok - qualified with a grimoire",
+			spell: "team:pods",
+
+			want: "team:pods",
+		},
+		{
+			name:  "ok - in a book",
+			book:  "k8s",
+			spell: "restart",
+
+			want: "me:k8s/restart",
+		},
+		{
+			name:  "ok - qualified with a grimoire and in a book",
+			book:  "k8s",
+			spell: "me:restart",
+
+			want: "me:k8s/restart",
+		},
+		{
+			name:  "error - qualified with the wrong grimoire",
+			spell: "team:logs",
+
+			err: fmt.Errorf("no spell named logs"),
+		},
+		{
+			name:  "error - no such spell",
+			spell: "nope",
+
+			err: fmt.Errorf("no spell named nope"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ref, err := lookupSpell(grimoires, tc.book, tc.spell)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if ref.String() != tc.want {
+				t.Errorf("got %s, want %s", ref, tc.want)
+			}
+		})
+	}
+}
+
+func TestListGrimoires(t *testing.T) {
+	grimoires := setupGrimoires(t)
+
+	refs, err := listGrimoires(grimoires)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result []string
+	for _, ref := range refs {
+		result = append(result, ref.String())
+	}
+
+	want := []string{"me:k8s/restart", "me:logs", "me:pods", "team:deploy"}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, want, test.Diff(result, want))
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Record is a single cast in the history log.
+type Record struct {
+	Time        time.Time         `json:"time"`
+	Name        string            `json:"name"`
+	Ref         string            `json:"ref,omitempty"` // Where the spell was read from, such as local:k8s/pods
+	Step        string            `json:"step,omitempty"`
+	Params      map[string]string `json:"params,omitempty"`
+	Command     string            `json:"command"`
+	Interpreter string            `json:"interpreter"`
+	Env         []string          `json:"env,omitempty"` // Names only, since values often hold secrets
+	Cwd         string            `json:"cwd"`
+	Timeout     time.Duration     `json:"timeout,omitempty"`
+	ExitCode    int               `json:"exit_code"`
+	Duration    time.Duration     `json:"duration"`
+}
+
+// envNames returns the names of the KEY=value environment variables in env.
+func envNames(env []string) []string {
+	var names []string
+	for _, variable := range env {
+		name, _, _ := strings.Cut(variable, "=")
+		names = append(names, name)
+	}
+	return names
+}
+
+// recastEnv rebuilds the environment a record was cast with from the spell's
+// Env headers and the record's parameters, since only the names of the
+// variables are recorded. The names of variables whose values can't be
+// rebuilt are returned as missing. Older records kept the values, which are
+// used as they are.
+func recastEnv(entry Entry, record Record) (env []string, missing []string) {
+	values := make(map[string]string)
+	if t, err := parseTemplate(entry); err == nil {
+		for _, spell := range t.Env {
+			if variable, err := spell.Substitute(record.Params); err == nil {
+				name, _, _ := strings.Cut(variable, "=")
+				values[name] = variable
+			}
+		}
+	}
+
+	for _, name := range record.Env {
+		if strings.Contains(name, "=") {
+			env = append(env, name)
+		} else if variable, ok := values[name]; ok {
+			env = append(env, variable)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+
+	return env, missing
+}
+
+func historyPath(statePath string) string {
+	return filepath.Join(statePath, "history")
+}
+
+// lockHistory takes an exclusive lock on the history log, held until the
+// returned file is closed. The lock is kept in a file of its own, so that it
+// still holds when the log is replaced by rewriteHistory.
+func lockHistory(statePath string) (*os.File, error) {
+	if err := os.MkdirAll(statePath, 0755); err != nil {
+		return nil, err
+	}
+
+	lock, err := os.OpenFile(historyPath(statePath)+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// appendHistory adds a record to the end of the history log, which holds one
+// JSON encoded record per line. Only the user can read the log, since
+// parameters can be sensitive.
+func appendHistory(statePath string, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockHistory(statePath)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	file, err := os.OpenFile(historyPath(statePath), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	// Logs written before this was restricted are tightened too
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// rewriteHistory passes each record of the history log to rewrite, which
+// reports whether it changed the record, and replaces the log if any were.
+// The log is locked throughout, so that casts recorded meanwhile wait for it
+// rather than being lost.
+func rewriteHistory(statePath string, rewrite func(*Record) bool) error {
+	lock, err := lockHistory(statePath)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	records, err := readHistory(statePath)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for i := range records {
+		if rewrite(&records[i]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	return writeHistory(statePath, records)
+}
+
+// writeHistory replaces the history log with the records, in one step so that
+// it's never seen half written. The caller holds the log's lock.
+func writeHistory(statePath string, records []Record) error {
+	var contents []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		contents = append(append(contents, line...), '\n')
+	}
+
+	tmp := historyPath(statePath) + ".tmp"
+	if err := os.WriteFile(tmp, contents, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, historyPath(statePath))
+}
+
+// readHistory returns every record in the history log, oldest first.
+func readHistory(statePath string) ([]Record, error) {
+	file, err := os.Open(historyPath(statePath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, parseErrorf("%s: line %d: %v", historyPath(statePath), n, err)
+		}
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// filterHistory returns the records for the named spell whose command contains
+// text. An empty name or text matches every record.
+func filterHistory(records []Record, name, text string) []Record {
+	var filtered []Record
+	for _, record := range records {
+		if name != "" && record.Name != name {
+			continue
+		}
+		if !strings.Contains(record.Command, text) {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+	return filtered
+}
+
+// formatRecord formats a record as a single line for listing.
+func formatRecord(record Record) string {
+	return fmt.Sprintf("%s  %-20s  exit %-3d  %8s  %s",
+		record.Time.Local().Format("2006-01-02 15:04:05"),
+		record.Name,
+		record.ExitCode,
+		record.Duration.Round(time.Millisecond),
+		record.Command,
+	)
+}
+
+func historyCommand(conf Config, args []string) error {
+	var name string
+	var limit int
+	var failed bool
+	flagSet := flag.NewFlagSet("history", flag.ExitOnError)
+	flagSet.StringVar(&name, "s", "", "Only show casts of the named spell")
+	flagSet.IntVar(&limit, "n", 0, "Only show the most recent casts")
+	flagSet.BoolVar(&failed, "failed", false, "Only show casts that exited unsuccessfully")
+	flagSet.Parse(args)
+
+	records, err := readHistory(conf.StatePath)
+	if err != nil {
+		return err
+	}
+
+	records = filterHistory(records, name, strings.Join(flagSet.Args(), " "))
+
+	if failed {
+		var unsuccessful []Record
+		for _, record := range records {
+			if record.ExitCode != 0 {
+				unsuccessful = append(unsuccessful, record)
+			}
+		}
+		records = unsuccessful
+	}
+
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+
+	for _, record := range records {
+		fmt.Println(formatRecord(record))
+	}
+
+	return nil
+}
+
+// recastEntry reads the spell a record was cast from, found by its file, or by
+// its name for records that don't have the file.
+func recastEntry(conf Config, record Record) (Entry, error) {
+	name := record.Ref
+	if name == "" {
+		name = record.Name
+	}
+
+	ref, err := lookupSpell(conf.Grimoires, "", name)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return readSpellRef(ref)
+}
+
+// recastCommand lets the user pick a cast from the history log and casts its
+// final command again, in the same directory and environment.
+func recastCommand(conf Config, args []string) error {
+	var yes bool
+	var name string
+	flagSet := flag.NewFlagSet("recast", flag.ExitOnError)
+	flagSet.BoolVar(&yes, "yes", false, "Cast without asking for confirmation")
+	flagSet.StringVar(&name, "s", "", "Only offer casts of the named spell")
+	flagSet.Parse(args)
+
+	if flagSet.NArg() > 0 {
+		return usageErrorf("too many arguments")
+	}
+
+	records, err := readHistory(conf.StatePath)
+	if err != nil {
+		return err
+	}
+
+	records = filterHistory(records, name, "")
+	if len(records) == 0 {
+		fmt.Println("Nothing has been cast yet")
+		return nil
+	}
+
+	// Offer the most recent casts first
+	lines := make([]string, len(records))
+	for i, record := range records {
+		lines[len(records)-1-i] = formatRecord(record)
+	}
+
+	index, err := findLine(lines)
+	if err != nil {
+		return err
+	}
+	if index < 0 {
+		fmt.Fprintln(os.Stderr, "No cast selected")
+		return errCancelled
+	}
+
+	record := records[len(records)-1-index]
+
+	// The spell may have been changed or forgotten since it was cast, in
+	// which case its headers no longer apply.
+	entry := Entry{Name: record.Name}
+	if e, err := recastEntry(conf, record); err == nil {
+		entry = e
+	}
+
+	env, missing := recastEnv(entry, record)
+	if len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s can't be set again, the spell no longer provides them\n", strings.Join(missing, ", "))
+	}
+
+	inc := &Incantation{
+		Name:        record.Name,
+		Ref:         record.Ref,
+		Command:     record.Command,
+		Dir:         record.Cwd,
+		Env:         env,
+		Interpreter: record.Interpreter,
+		Params:      record.Params,
+		Step:        record.Step,
+		Timeout:     record.Timeout,
+		PreCast:     append(slices.Clone(conf.PreCast), entry.PreCast...),
+		PostCast:    append(slices.Clone(conf.PostCast), entry.PostCast...),
+	}
+
+	if err := confirmIncantation(conf, entry, inc, yes); err != nil {
+		return err
+	}
+
+	return castIncantation(conf, inc)
+}
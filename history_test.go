@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestHistory(t *testing.T) {
+	statePath := t.TempDir()
+
+	records, err := readHistory(statePath)
+	if err != nil {
+		t.Fatalf("unexpected error reading missing history: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("got %d records from missing history, want none", len(records))
+	}
+
+	want := []Record{
+		{
+			Time:        time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+			Name:        "pods",
+			Ref:         "local:k8s/pods",
+			Params:      map[string]string{"namespace": "web"},
+			Command:     "kubectl get pods -n web",
+			Interpreter: "bash",
+			Cwd:         "/tmp",
+			Timeout:     time.Minute,
+			Duration:    1500 * time.Millisecond,
+		},
+		{
+			Time:        time.Date(2025, 1, 2, 3, 5, 0, 0, time.UTC),
+			Name:        "fail",
+			Command:     "exit 3",
+			Interpreter: "sh",
+			Env:         []string{"A"},
+			Cwd:         "/",
+			ExitCode:    3,
+		},
+	}
+
+	for _, record := range want {
+		if err := appendHistory(statePath, record); err != nil {
+			t.Fatalf("unexpected error appending history: %v", err)
+		}
+	}
+
+	info, err := os.Stat(historyPath(statePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got history mode %v, want -rw-------", info.Mode().Perm())
+	}
+
+	records, err = readHistory(statePath)
+	if err != nil {
+		t.Fatalf("unexpected error reading history: %v", err)
+	}
+
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", records, want, test.Diff(records, want))
+	}
+
+	if got := filterHistory(records, "pods", ""); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("filter by name: got %#v, want %#v", got, want[:1])
+	}
+
+	if got := filterHistory(records, "", "exit"); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("filter by text: got %#v, want %#v", got, want[1:])
+	}
+}
+
+func TestRecastEnv(t *testing.T) {
+	entry := Entry{
+		Name:  "deploy",
+		Spell: "make deploy",
+		Env:   []string{"TOKEN=<token>", "STAGE=prod"},
+	}
+
+	var testCases = []struct {
+		name   string
+		entry  Entry
+		record Record
+
+		want        []string
+		wantMissing []string
+	}{
+		{
+			name:   "rebuilt from the spell",
+			entry:  entry,
+			record: Record{Env: []string{"TOKEN", "STAGE"}, Params: map[string]string{"token": "s3cret"}},
+
+			want: []string{"TOKEN=s3cret", "STAGE=prod"},
+		},
+		{
+			name:   "spell no longer sets it",
+			entry:  Entry{Name: "deploy", Spell: "make deploy", Env: []string{"STAGE=prod"}},
+			record: Record{Env: []string{"TOKEN", "STAGE"}, Params: map[string]string{"token": "s3cret"}},
+
+			want:        []string{"STAGE=prod"},
+			wantMissing: []string{"TOKEN"},
+		},
+		{
+			name:   "spell forgotten",
+			entry:  Entry{Name: "deploy"},
+			record: Record{Env: []string{"TOKEN"}},
+
+			wantMissing: []string{"TOKEN"},
+		},
+		{
+			name:   "older record with values",
+			entry:  Entry{Name: "deploy"},
+			record: Record{Env: []string{"TOKEN=old"}},
+
+			want: []string{"TOKEN=old"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, missing := recastEnv(tc.entry, tc.record)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", got, tc.want, test.Diff(got, tc.want))
+			}
+			if !reflect.DeepEqual(missing, tc.wantMissing) {
+				t.Errorf("got missing %v, want %v", missing, tc.wantMissing)
+			}
+		})
+	}
+}
+
+func TestRecastEntry(t *testing.T) {
+	g := Grimoire{Name: "local", Path: t.TempDir()}
+
+	// The spell's file isn't named after it, so it can't be found by name
+	contents := "Spell: make deploy\nName: deploy\nEnv: STAGE=prod\nTimeout: 5m\n"
+	if err := os.WriteFile(filepath.Join(g.Path, "ship"), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := Config{Grimoires: []Grimoire{g}}
+
+	var testCases = []struct {
+		name   string
+		record Record
+
+		want Entry
+		err  error
+	}{
+		{
+			name:   "ok - found by ref",
+			record: Record{Name: "deploy", Ref: "local:ship"},
+
+			want: Entry{Spell: "make deploy", Name: "deploy", Env: []string{"STAGE=prod"}, Timeout: 5 * time.Minute, Ref: "local:ship"},
+		},
+		{
+			name:   "error - older record with only the name",
+			record: Record{Name: "deploy"},
+
+			err: fmt.Errorf("no spell named deploy"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := recastEntry(conf, tc.record)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+		})
+	}
+}
+
+func TestRewriteHistory(t *testing.T) {
+	statePath := t.TempDir()
+	for _, name := range []string{"old", "other"} {
+		if err := appendHistory(statePath, Record{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A cast is recorded while the log is being rewritten, which has to wait
+	// for the rewrite rather than being lost to it
+	done := make(chan error)
+	err := rewriteHistory(statePath, func(record *Record) bool {
+		if record.Name != "old" {
+			return false
+		}
+		go func() { done <- appendHistory(statePath, Record{Name: "during"}) }()
+		time.Sleep(100 * time.Millisecond)
+
+		record.Name = "new"
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := readHistory(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, record := range records {
+		names = append(names, record.Name)
+	}
+	if want := []string{"new", "other", "during"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got history of %v, want %v", names, want)
+	}
+}
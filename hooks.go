@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// hookEnv returns the environment variables that describe a cast to its hooks.
+// The exit code and duration are only known once the spell has been cast, so
+// they are left out when finished is false.
+func hookEnv(inc *Incantation, finished bool, code int, duration time.Duration) []string {
+	env := []string{
+		"GRIMOIRE_SPELL=" + inc.Name,
+		"GRIMOIRE_STEP=" + inc.Step,
+		"GRIMOIRE_COMMAND=" + inc.Command,
+	}
+
+	if finished {
+		env = append(env,
+			"GRIMOIRE_EXIT_CODE="+strconv.Itoa(code),
+			"GRIMOIRE_DURATION="+strconv.FormatFloat(duration.Seconds(), 'f', 3, 64),
+		)
+	}
+
+	return env
+}
+
+// runHooks runs each hook with sh in turn, stopping at the first that fails.
+func runHooks(hooks []string, env []string) error {
+	for _, hook := range hooks {
+		cmd := exec.Command("sh", "-c", hook)
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("hook %q: %v", hook, err)
+		}
+	}
+
+	return nil
+}
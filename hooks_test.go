@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestRunHooks(t *testing.T) {
+	inc := &Incantation{Name: "pods", Command: "kubectl get pods"}
+
+	var testCases = []struct {
+		name     string
+		hooks    []string
+		finished bool
+
+		err error
+	}{
+		{
+			name:  "ok - no hooks",
+			hooks: nil,
+		},
+		{
+			name:  "ok - before cast",
+			hooks: []string{`test "$GRIMOIRE_SPELL" = pods`, `test "$GRIMOIRE_COMMAND" = "kubectl get pods"`, `test -z "$GRIMOIRE_EXIT_CODE"`},
+		},
+		{
+			name:     "ok - after cast",
+			hooks:    []string{`test "$GRIMOIRE_EXIT_CODE" = 3`, `test "$GRIMOIRE_DURATION" = 1.500`},
+			finished: true,
+		},
+		{
+			name:  "error - stops at first failure",
+			hooks: []string{"true", "exit 1", "exit 2"},
+
+			err: fmt.Errorf(`hook "exit 1": exit status 1`),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := runHooks(tc.hooks, hookEnv(inc, tc.finished, 3, 1500*time.Millisecond))
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+		})
+	}
+}
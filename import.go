@@ -0,0 +1,535 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// importer converts the snippets in one file of another tool's format into
+// spells. Anything that can't be converted is described by the notes it
+// returns.
+type importer func(name, contents string) (entries []Entry, notes []string, err error)
+
+// importers maps each format that can be imported to the file extension its
+// snippets are kept in and the importer that converts them.
+var importers = map[string]struct {
+	ext    string
+	parse  importer
+	source string
+}{
+	"pet":  {ext: ".toml", parse: importPet, source: "pet (https://github.com/knqyf263/pet)"},
+	"navi": {ext: ".cheat", parse: importNavi, source: "navi (https://github.com/denisidoro/navi)"},
+	"tldr": {ext: ".md", parse: importTldr, source: "tldr (https://tldr.sh)"},
+}
+
+// maxImportedName is how long a name made from a snippet's description may be.
+const maxImportedName = 40
+
+// importedName returns a name for an imported spell made from its
+// description, or from its command if it has no description.
+func importedName(desc, command string) string {
+	text := desc
+	if text == "" {
+		text = command
+	}
+
+	name := SanitizeFilename(strings.Join(strings.Fields(text), " "))
+	if len(name) > maxImportedName {
+		name = name[:maxImportedName]
+		if i := strings.LastIndex(name, "_"); i > 0 {
+			name = name[:i]
+		}
+	}
+
+	return strings.Trim(name, "_-")
+}
+
+// joinLines joins a command written over several lines into one, as spells are
+// kept on a single line. Lines ending with a backslash continue the same
+// command, as do lines left open by a keyword or operator such as do or |,
+// and any others are run one after the other.
+func joinLines(command string) string {
+	var joined strings.Builder
+
+	sep := ""
+	for _, line := range strings.Split(strings.TrimSpace(command), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		joined.WriteString(sep)
+		if continued, ok := strings.CutSuffix(line, "\\"); ok {
+			joined.WriteString(strings.TrimSpace(continued))
+			sep = " "
+		} else {
+			joined.WriteString(line)
+			sep = "; "
+			if lineIsOpen(line) {
+				sep = " "
+			}
+		}
+	}
+
+	return joined.String()
+}
+
+// lineIsOpen reports whether the shell carries on reading the command on the
+// next line, where a ; can't be put between the two.
+func lineIsOpen(line string) bool {
+	for _, op := range []string{"|", "&", ";", "{", "("} {
+		if strings.HasSuffix(line, op) {
+			return true
+		}
+	}
+
+	fields := strings.Fields(line)
+	switch fields[len(fields)-1] {
+	case "do", "then", "else", "in":
+		return true
+	}
+	return false
+}
+
+// petChoices matches the choices pet allows as a parameter's default, written
+// as <param=|_a_||_b_|>.
+var petChoices = regexp.MustCompile(`^\|_(.*)_\|$`)
+
+// importPet converts a pet snippet file, which is TOML. pet's parameters are
+// already written like grimoire's, except for choices between defaults.
+func importPet(name, contents string) ([]Entry, []string, error) {
+	snippets, err := parsePetSnippets(contents)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []Entry
+	for _, snippet := range snippets {
+		command := paramRegex.ReplaceAllStringFunc(joinLines(snippet.values["command"]), func(param string) string {
+			name, def, ok := strings.Cut(param[1:len(param)-1], "=")
+			if m := petChoices.FindStringSubmatch(def); ok && m != nil {
+				def = strings.Join(strings.Split(m[1], "_||_"), ";")
+				return "<" + name + "=" + def + ">"
+			}
+			return param
+		})
+
+		desc := snippet.values["description"]
+		entries = append(entries, Entry{
+			Spell: command,
+			Name:  importedName(desc, command),
+			Desc:  desc,
+			Tags:  snippet.lists["tag"],
+		})
+	}
+
+	return entries, nil, nil
+}
+
+// petSnippet holds the values of a [[snippets]] table in a pet snippet file.
+type petSnippet struct {
+	values map[string]string
+	lists  map[string][]string
+}
+
+// parsePetSnippets parses the subset of TOML that pet writes its snippets in,
+// which is a list of [[snippets]] tables holding strings and arrays of
+// strings.
+func parsePetSnippets(contents string) ([]petSnippet, error) {
+	var snippets []petSnippet
+
+	lines := strings.Split(contents, "\n")
+	for n := 0; n < len(lines); n++ {
+		line := strings.TrimSpace(lines[n])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if line == "[[snippets]]" {
+			snippets = append(snippets, petSnippet{values: map[string]string{}, lists: map[string][]string{}})
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || len(snippets) == 0 {
+			return nil, fmt.Errorf("line %d: expected [[snippets]] or key = value", n+1)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		snippet := snippets[len(snippets)-1]
+
+		// Multi-line strings and arrays continue until they are closed
+		start := n
+		for (strings.HasPrefix(value, `"""`) && (len(value) < 6 || !strings.HasSuffix(value, `"""`))) ||
+			(strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]")) {
+			n++
+			if n == len(lines) {
+				return nil, fmt.Errorf("line %d: %s is never closed", start+1, key)
+			}
+			value += "\n" + lines[n]
+		}
+
+		if strings.HasPrefix(value, "[") {
+			var list []string
+			rest := strings.TrimSpace(value[1 : len(value)-1])
+			for rest != "" {
+				item, after, err := parseTOMLString(rest)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s: %w", start+1, key, err)
+				}
+				list = append(list, item)
+				rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(after), ","))
+			}
+			snippet.lists[key] = list
+			continue
+		}
+
+		s, rest, err := parseTOMLString(value)
+		if err != nil || strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("line %d: %s: expected a string", start+1, key)
+		}
+		snippet.values[key] = s
+	}
+
+	return snippets, nil
+}
+
+// parseTOMLString parses the TOML string at the start of s, returning it and
+// what follows it.
+func parseTOMLString(s string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(s, `"""`):
+		end := strings.Index(s[3:], `"""`)
+		if end < 0 {
+			return "", "", errors.New("unterminated string")
+		}
+		// A newline right after the opening quotes isn't part of the string
+		value, err := unescapeTOML(strings.TrimPrefix(s[3:3+end], "\n"))
+		return value, s[end+6:], err
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				value, err := unescapeTOML(s[1:i])
+				return value, s[i+1:], err
+			}
+		}
+		return "", "", errors.New("unterminated string")
+	case strings.HasPrefix(s, "'"):
+		end := strings.Index(s[1:], "'")
+		if end < 0 {
+			return "", "", errors.New("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	default:
+		return "", "", fmt.Errorf("expected a string, got %s", s)
+	}
+}
+
+// unescapeTOML replaces the escape sequences in the contents of a TOML basic
+// string with the characters they stand for.
+func unescapeTOML(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return "", errors.New("string ends with a backslash")
+		}
+
+		switch s[i] {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case '"', '\\':
+			b.WriteByte(s[i])
+		case 'u', 'U':
+			size := 4
+			if s[i] == 'U' {
+				size = 8
+			}
+			if i+size >= len(s) {
+				return "", fmt.Errorf("invalid escape \\%s", s[i:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape \\%s", s[i:i+1+size])
+			}
+			b.WriteRune(rune(r))
+			i += size
+		default:
+			return "", fmt.Errorf("invalid escape \\%c", s[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+// importNavi converts a navi cheatsheet. Its parameters are already written
+// like grimoire's, but grimoire has no equivalent to navi's commands that
+// suggest values for a parameter, so those are noted instead.
+func importNavi(name, contents string) ([]Entry, []string, error) {
+	var entries []Entry
+	var notes []string
+	var tags []string
+	var desc string
+	var command []string
+
+	flush := func() {
+		if len(command) > 0 {
+			spell := joinLines(strings.Join(command, "\n"))
+			entries = append(entries, Entry{
+				Spell: spell,
+				Name:  importedName(desc, spell),
+				Desc:  desc,
+				Tags:  tags,
+			})
+		}
+		desc = ""
+		command = nil
+	}
+
+	for _, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "%"):
+			flush()
+			tags = splitList(strings.TrimPrefix(trimmed, "%"))
+		case strings.HasPrefix(trimmed, "#"):
+			flush()
+			desc = strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+		case strings.HasPrefix(trimmed, "$"):
+			flush()
+			variable, _, _ := strings.Cut(strings.TrimPrefix(trimmed, "$"), ":")
+			notes = append(notes, fmt.Sprintf("values for <%s> are suggested by a command in navi, it will be prompted for instead", strings.TrimSpace(variable)))
+		case strings.HasPrefix(trimmed, ";"), strings.HasPrefix(trimmed, "@"):
+			// Comments and references to other cheatsheets
+		default:
+			command = append(command, line)
+		}
+	}
+	flush()
+
+	return entries, notes, nil
+}
+
+// tldrPlaceholder matches a placeholder in a tldr page, such as {{path/to/file}}
+// or an option such as {{[-v|--verbose]}}.
+var tldrPlaceholder = regexp.MustCompile(`\{\{(.*?)\}\}`)
+
+// importTldr converts a tldr page, in which each example is a description
+// starting with "- " followed by a command in backticks. Placeholders become
+// parameters named after the placeholder, and options that can be written
+// short or long are written long.
+func importTldr(name, contents string) ([]Entry, []string, error) {
+	page := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+
+	var entries []Entry
+	var desc string
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+
+		if text, ok := strings.CutPrefix(line, "- "); ok {
+			desc = strings.TrimSuffix(strings.TrimSpace(text), ":")
+			continue
+		}
+
+		if len(line) < 2 || !strings.HasPrefix(line, "`") || !strings.HasSuffix(line, "`") {
+			continue
+		}
+
+		command := tldrPlaceholder.ReplaceAllStringFunc(line[1:len(line)-1], func(placeholder string) string {
+			text := placeholder[2 : len(placeholder)-2]
+
+			if options, ok := strings.CutPrefix(text, "["); ok && strings.HasSuffix(options, "]") {
+				alternatives := strings.Split(strings.TrimSuffix(options, "]"), "|")
+				return alternatives[len(alternatives)-1]
+			}
+
+			// Parameter names can't hold the characters used to write
+			// parameters, and need at least two characters
+			param := strings.TrimSpace(strings.NewReplacer("<", "", ">", "", "=", "_", ";", "_").Replace(text))
+			if len(param) < 2 {
+				param += "_"
+			}
+			return "<" + param + ">"
+		})
+
+		entries = append(entries, Entry{
+			Spell: command,
+			Name:  importedName(page+" "+desc, command),
+			Desc:  desc,
+			Tags:  []string{page},
+		})
+		desc = ""
+	}
+
+	return entries, nil, nil
+}
+
+// importFiles returns the files to import from path, which is either a single
+// file or a directory holding files with the extension ext.
+func importFiles(root, ext string) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && filepath.Ext(path) == ext {
+			files = append(files, path)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// normalizeCommand returns a command with its whitespace normalized, so that
+// commands which only differ in spacing are found to be the same.
+func normalizeCommand(command string) string {
+	return strings.Join(strings.Fields(command), " ")
+}
+
+// importCommand imports snippets from another tool into the first writable
+// grimoire. Snippets that are the same as an existing spell are skipped, as
+// are those that can't be converted, and both are reported.
+func importCommand(conf Config, args []string) error {
+	var from, book string
+	flagSet := flag.NewFlagSet("import", flag.ExitOnError)
+	flagSet.StringVar(&from, "from", "", "The format to import from: pet, navi or tldr")
+	flagSet.StringVar(&book, "book", "", "Add the spells to a book within the grimoire, such as k8s")
+	flagSet.Parse(args)
+
+	format, ok := importers[from]
+	if !ok {
+		return usageErrorf("--from: expected one of pet, navi or tldr, got %q", from)
+	}
+
+	if flagSet.NArg() == 0 {
+		return usageErrorf("expected a file or directory to import")
+	}
+
+	if err := checkBook(book); err != nil {
+		return usageErrorf("%v", err)
+	}
+
+	g, err := spellPathGrimoire(conf)
+	if err != nil {
+		return err
+	}
+
+	// Spells are skipped if their command is already in a grimoire
+	existing := make(map[string]string)
+	refs, err := listGrimoires(conf.Grimoires)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if entry, err := readSpellRef(ref); err == nil && entry.Spell != "" {
+			existing[normalizeCommand(entry.Spell)] = ref.Name
+		}
+	}
+
+	var imported, skipped []string
+	for _, root := range flagSet.Args() {
+		files, err := importFiles(root, format.ext)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			contents, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+
+			entries, notes, err := format.parse(file, string(contents))
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("%s: %v", file, err))
+				continue
+			}
+			for _, note := range notes {
+				fmt.Fprintf(os.Stderr, "Note: %s: %s\n", file, note)
+			}
+
+			for _, entry := range entries {
+				command := normalizeCommand(entry.Spell)
+				if name, ok := existing[command]; ok {
+					skipped = append(skipped, fmt.Sprintf("%s: same as %s", entry.Spell, name))
+					continue
+				}
+
+				if _, err := ParseSpell(entry.Spell); err != nil {
+					skipped = append(skipped, fmt.Sprintf("%s: %v", entry.Spell, err))
+					continue
+				}
+
+				if entry.Name == "" {
+					entry.Name = from
+				}
+
+				// Snippets with the same name are numbered
+				base := entry.Name
+				for i := 2; ; i++ {
+					if _, err := os.Stat(filepath.Join(g.Path, book, entry.Name)); errors.Is(err, os.ErrNotExist) {
+						break
+					}
+					entry.Name = fmt.Sprintf("%s-%d", base, i)
+				}
+
+				if err := writeSpell(filepath.Join(g.Path, book), entry); err != nil {
+					return err
+				}
+
+				name := path.Join(book, entry.Name)
+				existing[command] = name
+				imported = append(imported, name)
+			}
+		}
+	}
+
+	fmt.Printf("Imported %d spells from %s into %s\n", len(imported), format.source, g.Name)
+
+	if len(skipped) > 0 {
+		fmt.Printf("Skipped %d:\n", len(skipped))
+		for _, skip := range skipped {
+			fmt.Printf("  %s\n", skip)
+		}
+	}
+
+	if len(imported) > 0 {
+		autoCommit(conf, g, fmt.Sprintf("Import %d spells from %s", len(imported), from), imported...)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestImportPet(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		contents string
+
+		want []Entry
+		err  error
+	}{
+		{
+			name: "ok - parameters and choices",
+			contents: `
+[[snippets]]
+  description = "Ping a host"
+  command = "ping -c <count=3> <host>"
+  tag = ["network", "debug"]
+  output = ""
+
+[[snippets]]
+  description = "Show \"pods\""
+  command = 'kubectl get pods -o <format=|_wide_||_yaml_|>'
+  tag = []
+`,
+
+			want: []Entry{
+				{Spell: "ping -c <count=3> <host>", Name: "ping_a_host", Desc: "Ping a host", Tags: []string{"network", "debug"}},
+				{Spell: "kubectl get pods -o <format=wide;yaml>", Name: "show_pods", Desc: `Show "pods"`},
+			},
+		},
+		{
+			name: "ok - multi-line command",
+			contents: `
+[[snippets]]
+description = "Build and test"
+command = """
+make build
+make test"""
+`,
+
+			want: []Entry{
+				{Spell: "make build; make test", Name: "build_and_test", Desc: "Build and test"},
+			},
+		},
+		{
+			name:     "error - key outside of a snippet",
+			contents: `command = "ls"`,
+
+			err: fmt.Errorf("line 1: expected [[snippets]] or key = value"),
+		},
+		{
+			name:     "error - unterminated string",
+			contents: "[[snippets]]\ncommand = \"ls",
+
+			err: fmt.Errorf("line 2: command: expected a string"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, _, err := importPet("snippet.toml", tc.contents)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+		})
+	}
+}
+
+func TestJoinLines(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		command string
+
+		want string
+	}{
+		{
+			name:    "one after the other",
+			command: "make\nmake install\n",
+
+			want: "make; make install",
+		},
+		{
+			name:    "continued",
+			command: "git rebase main \\\n  --autostash",
+
+			want: "git rebase main --autostash",
+		},
+		{
+			name:    "loop",
+			command: "for f in *; do\necho $f\ndone",
+
+			want: "for f in *; do echo $f; done",
+		},
+		{
+			name:    "if",
+			command: "if [ -f go.mod ]; then\ngo build\nelse\nmake\nfi",
+
+			want: "if [ -f go.mod ]; then go build; else make; fi",
+		},
+		{
+			name:    "function",
+			command: "greet() {\necho hi\n}",
+
+			want: "greet() { echo hi; }",
+		},
+		{
+			name:    "operators",
+			command: "ps aux |\ngrep go &&\necho found ||\necho none",
+
+			want: "ps aux | grep go && echo found || echo none",
+		},
+		{
+			name:    "case",
+			command: "case $1 in\na) echo a;;\nesac",
+
+			want: "case $1 in a) echo a;; esac",
+		},
+		{
+			name:    "ended with ;",
+			command: "cd /tmp;\nls",
+
+			want: "cd /tmp; ls",
+		},
+	}
+
+	bash, _ := exec.LookPath("bash")
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := joinLines(tc.command)
+			if result != tc.want {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+
+			if bash == "" {
+				return
+			}
+			if out, err := exec.Command(bash, "-n", "-c", result).CombinedOutput(); err != nil {
+				t.Errorf("bash -n %q: %v\n%s", result, err, out)
+			}
+		})
+	}
+}
+
+func TestImportNavi(t *testing.T) {
+	contents := `% git, code
+
+# Change branch
+git checkout <branch>
+
+$ branch: git branch | awk '{print $NF}'
+
+# Rebase and push
+git rebase <base> \
+  --autostash
+git push --force-with-lease
+`
+
+	want := []Entry{
+		{Spell: "git checkout <branch>", Name: "change_branch", Desc: "Change branch", Tags: []string{"git", "code"}},
+		{Spell: "git rebase <base> --autostash; git push --force-with-lease", Name: "rebase_and_push", Desc: "Rebase and push", Tags: []string{"git", "code"}},
+	}
+	wantNotes := []string{"values for <branch> are suggested by a command in navi, it will be prompted for instead"}
+
+	result, notes, err := importNavi("git.cheat", contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, want, test.Diff(result, want))
+	}
+	if !reflect.DeepEqual(notes, wantNotes) {
+		t.Errorf("unexpected notes\ngot: %#v\nwant:%#v", notes, wantNotes)
+	}
+}
+
+func TestImportTldr(t *testing.T) {
+	contents := "# tar\n\n> Archiving utility.\n\n" +
+		"- [c]reate an archive and write it to a [f]ile:\n\n" +
+		"`tar cf {{path/to/target.tar}} {{path/to/file1 path/to/file2 ...}}`\n\n" +
+		"- List the contents of a tar file [v]erbosely:\n\n" +
+		"`tar {{[-t|--list]}} {{[-v|--verbose]}} -f {{path/to/source.tar}}`\n"
+
+	want := []Entry{
+		{
+			Spell: "tar cf <path/to/target.tar> <path/to/file1 path/to/file2 ...>",
+			Name:  "tar_create_an_archive_and_write_it_to_a",
+			Desc:  "[c]reate an archive and write it to a [f]ile",
+			Tags:  []string{"tar"},
+		},
+		{
+			Spell: "tar --list --verbose -f <path/to/source.tar>",
+			Name:  "tar_list_the_contents_of_a_tar_file",
+			Desc:  "List the contents of a tar file [v]erbosely",
+			Tags:  []string{"tar"},
+		},
+	}
+
+	result, _, err := importTldr("pages/common/tar.md", contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, want, test.Diff(result, want))
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// defaultInterpreter casts spells that don't choose an interpreter of their own.
+const defaultInterpreter = "bash"
+
+// shells are interpreters that take a script to run with -c.
+var shells = map[string]bool{
+	"sh":   true,
+	"bash": true,
+	"zsh":  true,
+	"fish": true,
+	"dash": true,
+	"ksh":  true,
+	"mksh": true,
+}
+
+// interpreterArgs returns the arguments to run script with interpreter, which
+// is a program name optionally followed by arguments for it. Shells are given
+// the script with -c. Any other interpreter is given the script as its final
+// argument, unless its last argument is "-" in which case the script should be
+// written to its stdin instead, which is reported by returning true.
+func interpreterArgs(interpreter, script string) ([]string, bool, error) {
+	args := strings.Fields(interpreter)
+	if len(args) == 0 {
+		return nil, false, errors.New("no interpreter given")
+	}
+
+	if shells[filepath.Base(args[0])] {
+		return append(args, "-c", script), false, nil
+	}
+
+	if args[len(args)-1] == "-" {
+		return args, true, nil
+	}
+
+	return append(args, script), false, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestInterpreterArgs(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		interpreter string
+		script      string
+
+		want      []string
+		wantStdin bool
+		err       error
+	}{
+		{
+			name:        "ok - shell",
+			interpreter: "zsh",
+			script:      "print -l *(.)",
+
+			want: []string{"zsh", "-c", "print -l *(.)"},
+		},
+		{
+			name:        "ok - shell by path with options",
+			interpreter: "/usr/bin/bash -eu",
+			script:      "echo $HOME",
+
+			want: []string{"/usr/bin/bash", "-eu", "-c", "echo $HOME"},
+		},
+		{
+			name:        "ok - script as argument",
+			interpreter: "python3 -c",
+			script:      "print('hi')",
+
+			want: []string{"python3", "-c", "print('hi')"},
+		},
+		{
+			name:        "ok - script on stdin",
+			interpreter: "python3 -",
+			script:      "print('hi')",
+
+			want:      []string{"python3", "-"},
+			wantStdin: true,
+		},
+		{
+			name:        "error - empty interpreter",
+			interpreter: "  ",
+			script:      "echo hi",
+
+			err: fmt.Errorf("no interpreter given"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, stdin, err := interpreterArgs(tc.interpreter, tc.script)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+			if stdin != tc.wantStdin {
+				t.Errorf("got stdin %v, want %v", stdin, tc.wantStdin)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Job is a spell cast in the background. Its state is saved alongside its log
+// so that the jobs command can report on it after grimoire has exited. Only
+// the names of its environment variables are saved, and the values are passed
+// to the job's runner in its own environment.
+type Job struct {
+	ID          string       `json:"id"`
+	Incantation *Incantation `json:"incantation"`
+	PID         int          `json:"pid"`
+	Start       time.Time    `json:"start"`
+	End         time.Time    `json:"end,omitzero"`
+	ExitCode    *int         `json:"exit_code,omitempty"`
+}
+
+// Status describes whether the job is still running or how it finished.
+func (j *Job) Status() string {
+	if j.ExitCode != nil {
+		return fmt.Sprintf("exit %d", *j.ExitCode)
+	}
+
+	// Signal 0 only checks that the process exists
+	if j.PID > 0 && syscall.Kill(j.PID, 0) == nil {
+		return "running"
+	}
+
+	// The runner hasn't started yet, or exited without saving the spell's
+	// exit code
+	if j.PID == 0 && time.Since(j.Start) < 5*time.Second {
+		return "starting"
+	}
+	return "lost"
+}
+
+func jobsPath(statePath string) string {
+	return filepath.Join(statePath, "jobs")
+}
+
+func jobPath(statePath, id string) string {
+	return filepath.Join(jobsPath(statePath), id+".json")
+}
+
+func jobLogPath(statePath, id string) string {
+	return filepath.Join(jobsPath(statePath), id+".log")
+}
+
+func readJob(statePath, id string) (*Job, error) {
+	contents, err := os.ReadFile(jobPath(statePath, id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &exitError{code: exitNotFound, err: fmt.Errorf("no job %s", id)}
+		}
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(contents, &job); err != nil {
+		return nil, parseErrorf("job %s: %v", id, err)
+	}
+
+	return &job, nil
+}
+
+// writeJob saves the job's state, replacing the previous state in one step so
+// that it's never seen half written.
+func writeJob(statePath string, job *Job) error {
+	contents, err := json.MarshalIndent(job, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp := jobPath(statePath, job.ID) + ".tmp"
+	if err := os.WriteFile(tmp, contents, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, jobPath(statePath, job.ID))
+}
+
+// readJobs returns every job, oldest first.
+func readJobs(statePath string) ([]*Job, error) {
+	paths, err := filepath.Glob(filepath.Join(jobsPath(statePath), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*Job
+	for _, path := range paths {
+		job, err := readJob(statePath, strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Start.Before(jobs[j].Start)
+	})
+
+	return jobs, nil
+}
+
+// castInBackground detaches the incantation from the terminal and casts it
+// with its output logged to a file. The cast is run by another grimoire
+// process so that its exit code can be recorded once it finishes.
+func castInBackground(conf Config, inc *Incantation) error {
+	if err := os.MkdirAll(jobsPath(conf.StatePath), 0755); err != nil {
+		return err
+	}
+
+	saved := *inc
+	saved.Env = envNames(inc.Env)
+
+	now := time.Now()
+	job := &Job{
+		ID:          fmt.Sprintf("%s-%03d", now.Format("20060102-150405"), now.Nanosecond()/int(time.Millisecond)),
+		Incantation: &saved,
+		Start:       now,
+	}
+
+	if err := writeJob(conf.StatePath, job); err != nil {
+		return err
+	}
+
+	log, err := os.OpenFile(jobLogPath(conf.StatePath, job.ID), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(self, "__job", job.ID)
+	cmd.Env = append(os.Environ(), inc.Env...)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	// Start a new session so that the job outlives the terminal
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("spell casting fizzled: %v", err)
+	}
+
+	fmt.Printf("Casting in the background as job %s\n", job.ID)
+	fmt.Printf("Output is logged to %s\n", jobLogPath(conf.StatePath, job.ID))
+
+	return cmd.Process.Release()
+}
+
+// runJobCommand casts a background job. It is run by castInBackground in a
+// detached grimoire process with its output going to the job's log.
+func runJobCommand(conf Config, args []string) error {
+	if len(args) != 1 {
+		return usageErrorf("expected a job id")
+	}
+
+	job, err := readJob(conf.StatePath, args[0])
+	if err != nil {
+		return err
+	}
+
+	job.PID = os.Getpid()
+	if err := writeJob(conf.StatePath, job); err != nil {
+		return err
+	}
+
+	// The values were passed in the runner's environment by castInBackground,
+	// and are kept out of the job's state when it is saved again
+	inc := new(Incantation)
+	*inc = *job.Incantation
+	inc.Env = nil
+	for _, name := range job.Incantation.Env {
+		inc.Env = append(inc.Env, name+"="+os.Getenv(name))
+	}
+
+	cmd, err := incantationCommand(inc)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = nil
+
+	code, _, _, err := runHooked(conf, inc, cmd)
+	if err != nil {
+		code = exitFailure
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+
+	job.End = time.Now()
+	job.ExitCode = &code
+
+	notifyCast(conf, inc, code, job.End.Sub(job.Start))
+
+	return writeJob(conf.StatePath, job)
+}
+
+// jobsCommand lists background jobs, or prints the log of a single job,
+// following it until the job finishes with -f.
+func jobsCommand(conf Config, args []string) error {
+	var follow bool
+	flagSet := flag.NewFlagSet("jobs", flag.ExitOnError)
+	flagSet.BoolVar(&follow, "f", false, "Keep printing the job's log until it finishes")
+	flagSet.Parse(args)
+
+	// Get the remaining positional arguments
+	args = flagSet.Args()
+
+	if len(args) > 1 {
+		return usageErrorf("too many arguments")
+	}
+
+	if len(args) == 0 {
+		if follow {
+			return usageErrorf("-f needs a job id")
+		}
+
+		jobs, err := readJobs(conf.StatePath)
+		if err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			fmt.Printf("%s  %-20s  %-8s  %s\n", job.ID, job.Incantation.Name, job.Status(), job.Incantation.Command)
+		}
+
+		return nil
+	}
+
+	return tailJob(conf, args[0], follow)
+}
+
+// tailJob prints the log of a job, and if follow is set, keeps printing it as
+// it grows until the job is no longer running.
+func tailJob(conf Config, id string, follow bool) error {
+	job, err := readJob(conf.StatePath, id)
+	if err != nil {
+		return err
+	}
+
+	log, err := os.Open(jobLogPath(conf.StatePath, id))
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	for {
+		if _, err := io.Copy(os.Stdout, log); err != nil {
+			return err
+		}
+
+		if !follow || (job.Status() != "running" && job.Status() != "starting") {
+			break
+		}
+
+		time.Sleep(200 * time.Millisecond)
+
+		job, err = readJob(conf.StatePath, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Catch anything written between the last copy and the job finishing
+	if _, err := io.Copy(os.Stdout, log); err != nil {
+		return err
+	}
+
+	if follow {
+		fmt.Fprintf(os.Stderr, "Job %s: %s\n", id, job.Status())
+	}
+
+	return nil
+}
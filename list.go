@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+)
+
+// listCommand prints every spell that can be cast, with the book and grimoire
+// it is in and its description. A spell shadowed by one of the same name in an
+// earlier grimoire isn't listed.
+func listCommand(conf Config, args []string) error {
+	var book string
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	flagSet.StringVar(&book, "b", "", "Only list spells in the given book, such as k8s")
+	flagSet.Parse(args)
+
+	if flagSet.NArg() > 0 {
+		return usageErrorf("too many arguments")
+	}
+
+	if err := checkBook(book); err != nil {
+		return usageErrorf("%v", err)
+	}
+
+	refs, err := listGrimoires(conf.Grimoires)
+	if err != nil {
+		return err
+	}
+	refs = inBook(refs, book)
+
+	nameWidth, bookWidth, grimoireWidth := 0, 0, 0
+	descs := make([]string, len(refs))
+	for i, ref := range refs {
+		nameWidth = max(nameWidth, len(path.Base(ref.Name)))
+		bookWidth = max(bookWidth, len(ref.Book()))
+		grimoireWidth = max(grimoireWidth, len(ref.Grimoire.Name))
+
+		entry, err := readSpellRef(ref)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", ref.Path(), err)
+			continue
+		}
+		descs[i] = entry.Desc
+	}
+
+	for i, ref := range refs {
+		fmt.Printf("%-*s  %-*s  %-*s  %s\n",
+			nameWidth, path.Base(ref.Name),
+			bookWidth, ref.Book(),
+			grimoireWidth, ref.Grimoire.Name,
+			descs[i],
+		)
+	}
+
+	return nil
+}
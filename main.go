@@ -1,14 +1,17 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"toddgaunt.com/grimoire/config"
 )
 
 type Entry struct {
@@ -16,15 +19,70 @@ type Entry struct {
 	Name  string
 	Desc  string
 	Tags  []string
+	// Confirm requires the final command to be confirmed before it is cast.
+	Confirm bool
+	// Allow names the danger rules that this spell is allowed to match
+	// without a typed confirmation, or "all" to skip danger checks.
+	Allow []string
+	// Interpreter casts the spell instead of the configured default, such
+	// as zsh, fish, or python3 -c.
+	Interpreter string
+	// Dir is the working directory the spell is cast in.
+	Dir string
+	// Env holds KEY=value environment variables the spell is cast with.
+	Env []string
+	// Timeout is how long the spell may run before it is killed.
+	Timeout time.Duration
+	// Steps makes the spell a runbook, cast one step at a time.
+	Steps []Step
+	// PreCast and PostCast are hook commands run before and after the
+	// spell is cast, after any configured for every spell.
+	PreCast  []string
+	PostCast []string
+	// Root is the root of the project the spell belongs to, which a
+	// relative Dir is resolved against when the spell is cast.
+	Root string
+	// Ref is where the spell was read from, such as local:k8s/pods, so
+	// that a cast can be traced back to its spell.
+	Ref string
 }
 
 type Config struct {
-	// SpellPath is the location where spells are saved.
+	// SpellPath is the location where new spells are saved, which is the
+	// first grimoire that isn't read-only.
 	SpellPath string
+	// Grimoires are where spells are read from, in order of precedence.
+	Grimoires []Grimoire
 	// Editor specifes the editor to open a spell with when using the `edit` subcommand.
 	Editor string
 	// Currently ignored, Finder specifies the fuzzy finder program to use. Defaults to `fzf`.
 	Finder string
+	// StatePath is the location where state such as parameter contexts is saved.
+	StatePath string
+	// Confirm requires every cast to be confirmed before it is run.
+	Confirm bool
+	// DangerRules match destructive commands which must be confirmed by
+	// typing out the spell's name before they are cast.
+	DangerRules []DangerRule
+	// Interpreter casts spells which don't specify their own. Defaults to bash.
+	Interpreter string
+	// Jobs limits how many casts run at once when fanning out with --each.
+	Jobs int
+	// PreCast and PostCast are hook commands run before and after every
+	// spell is cast.
+	PreCast  []string
+	PostCast []string
+	// NotifyAfter is how long a spell must run for before its completion is
+	// notified, with zero meaning never.
+	NotifyAfter time.Duration
+	// Notify is how the terminal is notified: osc9, osc777, bell, or none.
+	Notify string
+	// Notifier is a command run to notify of completion, if any.
+	Notifier string
+	// Git commits changes to spells to a git repository in SpellPath.
+	Git bool
+	// GitRemote is the remote that spells are synced with.
+	GitRemote string
 }
 
 func main() {
@@ -36,28 +94,51 @@ func main() {
 	}
 
 	conf := Config{
-		SpellPath: filepath.Join(homeDir, "grimoire"),
-		Editor:    os.Getenv("EDITOR"),
-		Finder:    "fzf",
+		SpellPath:   filepath.Join(homeDir, "grimoire"),
+		Editor:      os.Getenv("EDITOR"),
+		Finder:      "fzf",
+		StatePath:   config.DefaultStatePath,
+		Interpreter: defaultInterpreter,
+		Jobs:        defaultJobs,
+		Notify:      defaultNotify,
+		GitRemote:   defaultGitRemote,
 	}
 
-	if err := checkFzf(); err != nil {
+	settings, err := config.Read(config.DefaultPath)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitParse)
 	}
 
-	if err := EnsurePathExists(conf.SpellPath); err != nil {
+	if err := applySettings(&conf, settings); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", config.DefaultPath, err)
+		os.Exit(exitParse)
+	}
+
+	if err := checkFzf(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if len(os.Args) < 2 {
-		err := mainCommand(conf)
-		if err != nil {
+	if conf.SpellPath != "" {
+		if err := EnsurePathExists(conf.SpellPath); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		return
+	}
+
+	// A project's own spells take precedence over every other grimoire. The
+	// configured grimoires keep their names if the project's clashes.
+	if cwd, err := os.Getwd(); err == nil {
+		if root, ok := findProject(cwd); ok {
+			g := projectGrimoire(root)
+			g.Name = uniqueGrimoireName(conf.Grimoires, g.Name)
+			conf.Grimoires = append([]Grimoire{g}, conf.Grimoires...)
+		}
+	}
+
+	if len(os.Args) < 2 {
+		exit(mainCommand(conf))
 	}
 
 	subcommand := os.Args[1]
@@ -73,21 +154,144 @@ func main() {
 		err = editCommand(conf, args)
 	case "view":
 		err = viewCommand(conf, args)
+	case "list":
+		err = listCommand(conf, args)
 	case "cast":
 		err = castCommand(conf, args)
 	case "echo":
 		err = echoCommand(conf, args)
 	case "forget":
-		err = forgetCommand(conf)
+		err = forgetCommand(conf, args)
+	case "move":
+		err = moveCommand(conf, args)
+	case "rename":
+		err = renameCommand(conf, args)
+	case "clone":
+		err = cloneCommand(conf, args)
+	case "import":
+		err = importCommand(conf, args)
+	case "export":
+		err = exportCommand(conf, args)
+	case "context":
+		err = contextCommand(conf, args)
+	case "history":
+		err = historyCommand(conf, args)
+	case "recast":
+		err = recastCommand(conf, args)
+	case "shell-init":
+		err = shellInitCommand(args)
+	case "jobs":
+		err = jobsCommand(conf, args)
+	case "sync":
+		err = syncCommand(conf, args)
+	case "__job":
+		err = runJobCommand(conf, args)
 	default:
 		fmt.Printf("Unknown subcommand: %s\n", subcommand)
 		usage()
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
-	if err != nil {
+	exit(err)
+}
+
+// exit reports err, if any, and exits with the matching exit code. Failed
+// spells and cancellations have already been reported by the time they get
+// here.
+func exit(err error) {
+	var failed *spellFailedError
+	if err != nil && !errors.As(err, &failed) && !errors.Is(err, errCancelled) {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 	}
+
+	os.Exit(exitCode(err))
+}
+
+// applySettings overrides the defaults in conf with those from the config file.
+func applySettings(conf *Config, settings config.Settings) error {
+	// SpellPath may be repeated to layer grimoires, the first taking
+	// precedence.
+	if values := settings["SpellPath"]; len(values) > 0 {
+		conf.Grimoires = nil
+		for _, value := range values {
+			g := parseGrimoire(value)
+			g.Name = uniqueGrimoireName(conf.Grimoires, g.Name)
+			conf.Grimoires = append(conf.Grimoires, g)
+		}
+
+		conf.SpellPath = ""
+		if g, err := writableGrimoire(conf.Grimoires); err == nil {
+			conf.SpellPath = g.Path
+		}
+	} else {
+		conf.Grimoires = []Grimoire{{Name: filepath.Base(conf.SpellPath), Path: conf.SpellPath}}
+	}
+
+	if value, ok := settings.Get("Editor"); ok {
+		conf.Editor = value
+	}
+
+	if value, ok := settings.Get("Interpreter"); ok {
+		conf.Interpreter = value
+	}
+
+	if value, ok := settings.Get("Jobs"); ok {
+		jobs, err := strconv.Atoi(value)
+		if err != nil || jobs < 1 {
+			return fmt.Errorf("Jobs: expected a positive number, got %q", value)
+		}
+		conf.Jobs = jobs
+	}
+
+	if value, ok := settings.Get("Confirm"); ok {
+		confirm, err := config.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Confirm: %w", err)
+		}
+		conf.Confirm = confirm
+	}
+
+	if value, ok := settings.Get("NotifyAfter"); ok {
+		after, err := time.ParseDuration(value)
+		if err != nil || after < 0 {
+			return fmt.Errorf("NotifyAfter: expected a duration such as 30s, got %q", value)
+		}
+		conf.NotifyAfter = after
+	}
+
+	if value, ok := settings.Get("Notify"); ok {
+		if _, err := notification(value, "", "", false); err != nil {
+			return fmt.Errorf("Notify: %w", err)
+		}
+		conf.Notify = value
+	}
+
+	if value, ok := settings.Get("Notifier"); ok {
+		conf.Notifier = value
+	}
+
+	if value, ok := settings.Get("Git"); ok {
+		git, err := config.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Git: %w", err)
+		}
+		conf.Git = git
+	}
+
+	if value, ok := settings.Get("GitRemote"); ok {
+		conf.GitRemote = value
+	}
+
+	conf.PreCast = settings["PreCast"]
+	conf.PostCast = settings["PostCast"]
+
+	rules, err := parseDangerRules(settings["Danger"])
+	if err != nil {
+		return fmt.Errorf("Danger: %w", err)
+	}
+	conf.DangerRules = rules
+
+	return nil
 }
 
 func usage() {
@@ -97,25 +301,64 @@ func usage() {
 	fmt.Println("  add  - Add a new spell to the grimoire")
 	fmt.Println("  edit - Edit an existing spell in the grimoire")
 	fmt.Println("  view - View details of a spell from the grimoire")
-	fmt.Println("  echo - Find a spell in the grimoire and print it to stdout")
+	fmt.Println("  list - List every spell with its book, the grimoire it is from and its description")
+	fmt.Println("  echo - Find a spell in the grimoire and print it to stdout with its parameters substituted")
 	fmt.Println("  cast - Cast a spell from the grimoire")
+	fmt.Println("  forget - Move a spell out of the grimoire into its forgotten folder")
+	fmt.Println("  move - Move a spell into another book, such as k8s, or . for the top of the grimoire")
+	fmt.Println("  rename - Rename a spell, changing its Name header, file and history, but not past background jobs")
+	fmt.Println("  clone - Copy a spell under a new name and edit the copy")
+	fmt.Println("  import - Import snippets from pet, navi or tldr as spells")
+	fmt.Println("  export - Export spells as Markdown, JSON, pet snippets or a navi cheatsheet")
+	fmt.Println("  context - Manage parameter values shared across spells (set, use, show)")
+	fmt.Println("  history - List spells that have been cast")
+	fmt.Println("  recast - Find a spell in the history and cast it again")
+	fmt.Println("  shell-init - Print code to insert spells into the command line of bash, zsh or fish")
+	fmt.Println("  jobs - List spells cast in the background, or print the log of one")
+	fmt.Println("  sync - Pull spells from the grimoire's git remote and push local changes")
+}
+
+// selectSpell returns the spell named in args, or lets the user find one if
+// none was named. Either way, only spells in the given book are considered.
+func selectSpell(conf Config, book string, args []string) (spellRef, error) {
+	if len(args) > 1 {
+		return spellRef{}, usageErrorf("too many arguments")
+	}
+
+	if err := checkBook(book); err != nil {
+		return spellRef{}, usageErrorf("%v", err)
+	}
+
+	if len(args) == 1 {
+		return lookupSpell(conf.Grimoires, book, args[0])
+	}
+
+	ref, ok, err := findSpell(conf.Grimoires, book)
+	if err != nil {
+		return spellRef{}, err
+	}
+
+	if !ok {
+		fmt.Fprintln(os.Stderr, "No spell selected")
+		return spellRef{}, errCancelled
+	}
+
+	return ref, nil
 }
 
 func mainCommand(conf Config) error {
 	// If no arguments are provided, start by launching fzf to find a spell
 	// path. If it exists, prompt the user to either edit, view, or cast the spell.
-	selection, err := find(conf.SpellPath)
+	ref, err := selectSpell(conf, "", nil)
 	if err != nil {
 		return err
 	}
 
-	if selection == "" {
-		fmt.Println("No spell selected")
-		return nil
-	}
+	// Qualify the name so that the same spell is used even if it is shadowed
+	selection := ref.String()
 
 	// Prompt the user with tab cycling
-	options := []string{"cast", "view", "edit", "echo"}
+	options := []string{"cast", "view", "edit", "echo", "copy"}
 	action, err := promptWithTabCycling(options)
 	if err != nil {
 		return err
@@ -124,7 +367,7 @@ func mainCommand(conf Config) error {
 	// If the user pressed escape or another key to avoid selecting
 	// an action, just do nothing.
 	if action == "" {
-		return nil
+		return errCancelled
 	}
 
 	switch action {
@@ -136,6 +379,8 @@ func mainCommand(conf Config) error {
 		err = viewCommand(conf, []string{selection})
 	case "echo":
 		err = echoCommand(conf, []string{selection})
+	case "copy":
+		err = echoCommand(conf, []string{"--copy", selection})
 	default:
 		fmt.Println("Invalid action")
 	}
@@ -144,17 +389,23 @@ func mainCommand(conf Config) error {
 }
 
 func readSpell(spellPath, filename string) (Entry, error) {
-	var entry Entry
-
 	filepath := path.Join(spellPath, filename)
 
 	contents, err := os.ReadFile(filepath)
 	if err != nil {
-		return entry, err
+		return Entry{}, err
 	}
 
-	// Parse the file contents
-	lines := strings.Split(string(contents), "\n")
+	return parseEntry(string(contents))
+}
+
+// parseEntry parses the headers of a spell file. Lines that aren't headers,
+// such as # comments, are ignored.
+func parseEntry(contents string) (Entry, error) {
+	var entry Entry
+	var err error
+
+	lines := strings.Split(contents, "\n")
 
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -169,13 +420,36 @@ func readSpell(spellPath, filename string) (Entry, error) {
 		} else if strings.HasPrefix(line, "Description: ") {
 			entry.Desc = strings.TrimPrefix(line, "Description: ")
 		} else if strings.HasPrefix(line, "Tags: ") {
-			tagsStr := strings.TrimPrefix(line, "Tags: ")
-			if tagsStr != "" {
-				tags := strings.Split(tagsStr, ",")
-				for i := range tags {
-					tags[i] = strings.TrimSpace(tags[i])
-				}
-				entry.Tags = tags
+			entry.Tags = splitList(strings.TrimPrefix(line, "Tags: "))
+		} else if strings.HasPrefix(line, "Interpreter: ") {
+			entry.Interpreter = strings.TrimPrefix(line, "Interpreter: ")
+		} else if strings.HasPrefix(line, "Shell: ") {
+			entry.Interpreter = strings.TrimPrefix(line, "Shell: ")
+		} else if strings.HasPrefix(line, "Dir: ") {
+			entry.Dir = strings.TrimPrefix(line, "Dir: ")
+		} else if strings.HasPrefix(line, "Env: ") {
+			env := strings.TrimPrefix(line, "Env: ")
+			if key, _, ok := strings.Cut(env, "="); !ok || strings.TrimSpace(key) == "" {
+				return entry, parseErrorf("Env: expected KEY=value, got %s", env)
+			}
+			entry.Env = append(entry.Env, env)
+		} else if strings.HasPrefix(line, "Step: ") {
+			entry.Steps = append(entry.Steps, parseStep(strings.TrimPrefix(line, "Step: ")))
+		} else if strings.HasPrefix(line, "PreCast: ") {
+			entry.PreCast = append(entry.PreCast, strings.TrimPrefix(line, "PreCast: "))
+		} else if strings.HasPrefix(line, "PostCast: ") {
+			entry.PostCast = append(entry.PostCast, strings.TrimPrefix(line, "PostCast: "))
+		} else if strings.HasPrefix(line, "Timeout: ") {
+			entry.Timeout, err = time.ParseDuration(strings.TrimPrefix(line, "Timeout: "))
+			if err != nil {
+				return entry, parseErrorf("Timeout: %v", err)
+			}
+		} else if strings.HasPrefix(line, "Allow: ") {
+			entry.Allow = splitList(strings.TrimPrefix(line, "Allow: "))
+		} else if strings.HasPrefix(line, "Confirm: ") {
+			entry.Confirm, err = config.ParseBool(strings.TrimPrefix(line, "Confirm: "))
+			if err != nil {
+				return entry, parseErrorf("Confirm: %v", err)
 			}
 		}
 	}
@@ -193,6 +467,10 @@ func writeSpell(spellPath string, entry Entry) error {
 		return fmt.Errorf("spell %s already exists as %s", entry.Name, filename)
 	}
 
+	if err := os.MkdirAll(spellPath, 0755); err != nil {
+		return err
+	}
+
 	// Create the file content
 	content := fmt.Sprintf(
 		"Spell: %s\nName: %s\nDescription: %s",
@@ -201,11 +479,47 @@ func writeSpell(spellPath string, entry Entry) error {
 		entry.Desc,
 	)
 
+	for _, step := range entry.Steps {
+		content += fmt.Sprintf("\nStep: %s", formatStep(step))
+	}
+
 	// Add tags if provided
 	if len(entry.Tags) > 0 {
 		content += fmt.Sprintf("\nTags: %s", strings.Join(entry.Tags, ", "))
 	}
 
+	if entry.Interpreter != "" {
+		content += fmt.Sprintf("\nInterpreter: %s", entry.Interpreter)
+	}
+
+	if entry.Dir != "" {
+		content += fmt.Sprintf("\nDir: %s", entry.Dir)
+	}
+
+	for _, env := range entry.Env {
+		content += fmt.Sprintf("\nEnv: %s", env)
+	}
+
+	if entry.Timeout > 0 {
+		content += fmt.Sprintf("\nTimeout: %s", entry.Timeout)
+	}
+
+	for _, hook := range entry.PreCast {
+		content += fmt.Sprintf("\nPreCast: %s", hook)
+	}
+
+	for _, hook := range entry.PostCast {
+		content += fmt.Sprintf("\nPostCast: %s", hook)
+	}
+
+	if entry.Confirm {
+		content += "\nConfirm: yes"
+	}
+
+	if len(entry.Allow) > 0 {
+		content += fmt.Sprintf("\nAllow: %s", strings.Join(entry.Allow, ", "))
+	}
+
 	// Write the file
 	if err := os.WriteFile(filepath, []byte(content), 0644); err != nil {
 		return err
@@ -218,90 +532,162 @@ func writeSpell(spellPath string, entry Entry) error {
 
 func addCommand(conf Config, args []string) error {
 	// Parse args for -t flag using the go flag package
-	var tags string
+	var tags, book, shell string
+	var local, fromHistory, suggest bool
 	flagSet := flag.NewFlagSet("add", flag.ExitOnError)
 	flagSet.StringVar(&tags, "t", "", "Specify comma-delimited tags for the spell")
+	flagSet.BoolVar(&local, "local", false, "Add the spell to the current project's "+projectDir+" directory")
+	flagSet.StringVar(&book, "book", "", "Add the spell to a book within the grimoire, such as k8s")
+	flagSet.BoolVar(&fromHistory, "from-history", false, "Pick the spell from the shell's history")
+	flagSet.StringVar(&shell, "shell", "", "The shell whose history to pick from: bash, zsh or fish (defaults to $SHELL)")
+	flagSet.BoolVar(&suggest, "suggest", true, "Suggest parts of the spell that could be parameters")
 	flagSet.Parse(args)
 
+	if err := checkBook(book); err != nil {
+		return usageErrorf("%v", err)
+	}
+
 	// Get the remaining positional arguments
 	args = flagSet.Args()
 
+	g, err := spellPathGrimoire(conf)
+	if local {
+		g, err = localGrimoire(conf)
+	}
+	if err != nil {
+		return err
+	}
+
+	if fromHistory {
+		command, err := pickFromHistory(shell)
+		if err != nil {
+			return err
+		}
+		if command == "" {
+			fmt.Fprintln(os.Stderr, "No command selected")
+			return errCancelled
+		}
+
+		fmt.Fprintf(promptOut, "Spell>%s\n", command)
+		if suggest {
+			command, err = promptSuggestions(command)
+			if err != nil {
+				return err
+			}
+		}
+
+		command, err = promptPlaceholders(command)
+		if err != nil {
+			return err
+		}
+
+		// The picked command takes the place of the spell argument
+		args = append([]string{command}, args...)
+	}
+
 	entry, err := promptSpell(args)
 	if err != nil {
 		return err
 	}
 
-	if len(tags) > 0 {
-		entry.Tags = strings.Split(tags, ",")
-		for i := range entry.Tags {
-			entry.Tags[i] = strings.TrimSpace(entry.Tags[i])
+	// Spells from history have already had parameters suggested
+	if suggest && !fromHistory {
+		entry.Spell, err = promptSuggestions(entry.Spell)
+		if err != nil {
+			return err
 		}
 	}
 
-	err = writeSpell(conf.SpellPath, entry)
+	if len(tags) > 0 {
+		entry.Tags = splitList(tags)
+	}
+
+	// A spell that can't be cast isn't worth keeping
+	if _, err := parseTemplate(entry); err != nil {
+		return err
+	}
+
+	err = writeSpell(filepath.Join(g.Path, book), entry)
 	if err != nil {
 		return err
 	}
 
+	name := path.Join(book, entry.Name)
+	autoCommit(conf, g, fmt.Sprintf("Add spell %s", name), name)
+
 	return nil
 }
 
+// editCommand opens a spell in the editor. A spell from a read-only grimoire
+// can only be edited as a copy in the first writable grimoire, with --copy.
 func editCommand(conf Config, args []string) error {
-	if len(args) > 1 {
-		return fmt.Errorf("too many arguments")
+	var copy bool
+	var book string
+	flagSet := flag.NewFlagSet("edit", flag.ExitOnError)
+	flagSet.BoolVar(&copy, "copy", false, "Edit a copy of a spell from a read-only grimoire")
+	flagSet.StringVar(&book, "b", "", "Only find spells in the given book, such as k8s")
+	flagSet.Parse(args)
+
+	ref, err := selectSpell(conf, book, flagSet.Args())
+	if err != nil {
+		return err
 	}
 
-	selection := ""
-	if len(args) == 1 {
-		selection = args[0]
-	} else {
-		var err error
-		selection, err = find(conf.SpellPath)
+	if ref.Grimoire.ReadOnly && copy {
+		g, err := spellPathGrimoire(conf)
 		if err != nil {
 			return err
 		}
-	}
 
-	filepath := path.Join(conf.SpellPath, selection)
+		ref, err = copySpell(ref, g)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Copied %s into grimoire %s\n", ref.Name, g.Name)
+	}
 
-	// Fallback to vi if no editor is specified
-	editor := conf.Editor
-	if editor == "" {
-		editor = "vi"
+	if err := checkWritable(ref, "edit"); err != nil {
+		return fmt.Errorf("%w, use --copy to edit a copy", err)
 	}
 
-	// Start a subprocess to run the spell
-	cmd := exec.Command(editor, filepath)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+	name := spellName(ref)
+
+	saved, err := editSpell(spellEditor(conf), ref)
 	if err != nil {
-		return fmt.Errorf("editor misfire: %v", err)
+		return err
 	}
 
+	// The name it is cast under can also change without its file moving,
+	// such as when its Name header is removed
+	if saved != ref || spellName(saved) != name {
+		if err := moveSpellState(conf.StatePath, name, ref, saved); err != nil {
+			return err
+		}
+	}
+
+	if saved != ref {
+		fmt.Printf("%s renamed to %s\n", ref.Name, saved.Name)
+		autoCommit(conf, ref.Grimoire, fmt.Sprintf("Rename spell %s to %s", ref.Name, saved.Name), ref.Name, saved.Name)
+		return nil
+	}
+
+	autoCommit(conf, ref.Grimoire, fmt.Sprintf("Edit spell %s", ref.Name), ref.Name)
+
 	return nil
 }
 
 func viewCommand(conf Config, args []string) error {
-	if len(args) > 1 {
-		return fmt.Errorf("too many arguments")
-	}
+	var book string
+	flagSet := flag.NewFlagSet("view", flag.ExitOnError)
+	flagSet.StringVar(&book, "b", "", "Only find spells in the given book, such as k8s")
+	flagSet.Parse(args)
 
-	selection := ""
-	if len(args) == 1 {
-		selection = args[0]
-	} else {
-		var err error
-		selection, err = find(conf.SpellPath)
-		if err != nil {
-			return err
-		}
+	ref, err := selectSpell(conf, book, flagSet.Args())
+	if err != nil {
+		return err
 	}
 
-	filepath := path.Join(conf.SpellPath, selection)
-
-	contents, err := os.ReadFile(filepath)
+	contents, err := os.ReadFile(ref.Path())
 	if err != nil {
 		return err
 	}
@@ -315,110 +701,98 @@ func viewCommand(conf Config, args []string) error {
 	return nil
 }
 
+// echoCommand prints a spell with its parameters substituted, so that it can
+// be used in scripts such as $(grimoire echo <spell>).
 func echoCommand(conf Config, args []string) error {
-	if len(args) > 1 {
-		return fmt.Errorf("too many arguments")
-	}
+	var copy, raw bool
+	var book string
+	params := make(paramFlag)
+	flagSet := flag.NewFlagSet("echo", flag.ExitOnError)
+	flagSet.Var(params, "p", "Substitute a parameter with name=value rather than prompting for it")
+	flagSet.BoolVar(&raw, "raw", false, "Print the spell as written, without substituting parameters")
+	flagSet.BoolVar(&copy, "copy", false, "Copy the spell to the clipboard instead of printing it")
+	flagSet.StringVar(&book, "b", "", "Only find spells in the given book, such as k8s")
+	flagSet.Parse(args)
 
-	selection := ""
-	if len(args) == 1 {
-		selection = args[0]
-	} else {
-		var err error
-		selection, err = find(conf.SpellPath)
-		if err != nil {
-			return err
-		}
+	// Get the remaining positional arguments
+	args = flagSet.Args()
+
+	// The spell is printed to stdout, which is likely being captured
+	if !copy {
+		usePromptTTY()
 	}
 
-	entry, err := readSpell(conf.SpellPath, selection)
+	ref, err := selectSpell(conf, book, args)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("%s", entry.Spell)
-
-	return nil
-}
-
-func castCommand(conf Config, args []string) error {
-	if len(args) > 1 {
-		return fmt.Errorf("too many arguments")
+	entry, err := readSpellRef(ref)
+	if err != nil {
+		return fmt.Errorf("failed to read spell %s: %w", ref.Name, err)
 	}
 
-	selection := ""
-	if len(args) == 1 {
-		selection = args[0]
-	} else {
-		var err error
-		selection, err = find(conf.SpellPath)
-		if err != nil {
-			return err
-		}
+	inc, err := echoIncantation(conf, entry, params, raw)
+	if err != nil {
+		return err
 	}
 
-	if selection == "" {
-		fmt.Println("No spell selected")
-		return nil
+	if copy {
+		return copyIncantation(inc)
 	}
 
-	filepath := path.Join(conf.SpellPath, selection)
+	fmt.Printf("%s", inc.Command)
 
-	file, err := os.Open(filepath)
-	if err != nil {
-		return fmt.Errorf("failed to read spell %s: %v", filepath, err)
+	return nil
+}
+
+// echoIncantation returns the spell to echo, as written if raw, or else with
+// its parameters substituted from preset or prompted for.
+func echoIncantation(conf Config, entry Entry, preset map[string]string, raw bool) (*Incantation, error) {
+	if raw {
+		return &Incantation{Name: entry.Name, Command: entry.Spell}, nil
 	}
-	defer file.Close()
+	return prepareIncantation(conf, entry, preset)
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "Spell: ") {
-			spellText := strings.TrimPrefix(line, "Spell: ")
+// forgetCommand moves a spell into the forgotten folder, where it is no longer
+// found but can still be recovered. A spell forgotten more than once is kept
+// under a name that includes when it was forgotten.
+func forgetCommand(conf Config, args []string) error {
+	var book string
+	flagSet := flag.NewFlagSet("forget", flag.ExitOnError)
+	flagSet.StringVar(&book, "b", "", "Only find spells in the given book, such as k8s")
+	flagSet.Parse(args)
 
-			spell, err := ParseSpell(spellText)
-			if err != nil {
-				return err
-			}
+	ref, err := selectSpell(conf, book, flagSet.Args())
+	if err != nil {
+		return err
+	}
 
-			if len(spell.Params) > 0 {
-				spellText, err = promptSpellParameters(spell)
-				if err != nil {
-					return err
-				}
-			}
+	if err := checkWritable(ref, "forget"); err != nil {
+		return err
+	}
 
-			fmt.Printf("%s\n", spellText)
+	selection := ref.Name
+	from := ref.Path()
 
-			// Start a subprocess to run the spell
-			cmd := exec.Command("bash", "-c", spellText)
-			cmd.Stdin = os.Stdin
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			if err := cmd.Run(); err != nil {
-				fmt.Printf("Spell casting fizzled: %v\n", err)
-			}
-			break
-		}
+	forgotten := filepath.Join(forgottenDir, selection)
+	if _, err := os.Stat(filepath.Join(ref.Grimoire.Path, forgotten)); err == nil {
+		forgotten += "." + time.Now().Format("20060102T150405")
 	}
 
-	return nil
-}
-
-func forgetCommand(conf Config) error {
-	selection, err := find(conf.SpellPath)
-	if err != nil {
+	to := filepath.Join(ref.Grimoire.Path, forgotten)
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
 		return err
 	}
 
-	if selection == "" {
-		fmt.Printf("No spell selected")
-		return nil
+	if err := os.Rename(from, to); err != nil {
+		return err
 	}
 
-	filepath := path.Join(conf.SpellPath, selection)
+	fmt.Printf("Forgot %s, it can be recovered from %s\n", selection, to)
 
-	fmt.Printf("TODO: move %s into 'forgotten' folder\n", filepath)
+	autoCommit(conf, ref.Grimoire, fmt.Sprintf("Forget spell %s", selection), selection, forgotten)
 
 	return nil
 }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestParseEntry(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		contents string
+
+		want Entry
+		err  error
+	}{
+		{
+			name:     "ok - confirmed",
+			contents: "Spell: make deploy\nName: deploy\nConfirm: yes\n",
+
+			want: Entry{Spell: "make deploy", Name: "deploy", Confirm: true},
+		},
+		{
+			name:     "ok - not confirmed",
+			contents: "Spell: make\nName: build\nConfirm: no\n",
+
+			want: Entry{Spell: "make", Name: "build"},
+		},
+		{
+			name:     "ok - dir and env",
+			contents: "Spell: make\nName: build\nDir: ~/src/<app>\nEnv: GOOS=linux\nEnv: GOFLAGS=-trimpath -v\n",
+
+			want: Entry{Spell: "make", Name: "build", Dir: "~/src/<app>", Env: []string{"GOOS=linux", "GOFLAGS=-trimpath -v"}},
+		},
+		{
+			name:     "ok - env with an empty value",
+			contents: "Spell: make\nName: build\nEnv: CGO_ENABLED=\n",
+
+			want: Entry{Spell: "make", Name: "build", Env: []string{"CGO_ENABLED="}},
+		},
+		{
+			name:     "error - env without a value",
+			contents: "Spell: make\nName: build\nEnv: GOOS\n",
+
+			err: fmt.Errorf("Env: expected KEY=value, got GOOS"),
+		},
+		{
+			name:     "error - env without a key",
+			contents: "Spell: make\nName: build\nEnv: =linux\n",
+
+			err: fmt.Errorf("Env: expected KEY=value, got =linux"),
+		},
+		{
+			name:     "error - bad confirm",
+			contents: "Spell: make deploy\nName: deploy\nConfirm: maybe\n",
+
+			err: fmt.Errorf(`Confirm: expected yes or no, got "maybe"`),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := parseEntry(tc.contents)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+		})
+	}
+}
+
+func TestEchoIncantation(t *testing.T) {
+	entry := Entry{Name: "logs", Spell: "kubectl logs -n <ns=default> <pod> --tail <lines=100>"}
+
+	var testCases = []struct {
+		name    string
+		preset  map[string]string
+		raw     bool
+		answers string
+
+		want string
+		err  error
+	}{
+		{
+			name:   "ok - every parameter preset",
+			preset: map[string]string{"ns": "web", "pod": "api-0", "lines": "20"},
+
+			want: "kubectl logs -n web api-0 --tail 20",
+		},
+		{
+			name:    "ok - the rest prompted for",
+			preset:  map[string]string{"pod": "api-0"},
+			answers: "kube-system\n\n",
+
+			want: "kubectl logs -n kube-system api-0 --tail 100",
+		},
+		{
+			name:   "ok - raw",
+			preset: map[string]string{"pod": "api-0"},
+			raw:    true,
+
+			want: "kubectl logs -n <ns=default> <pod> --tail <lines=100>",
+		},
+		{
+			name:   "error - no such parameter",
+			preset: map[string]string{"pod": "api-0", "container": "app"},
+
+			err: fmt.Errorf("spell logs has no parameter container"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldInput, oldOut := input, promptOut
+			t.Cleanup(func() { input, promptOut = oldInput, oldOut })
+			input = bufio.NewScanner(strings.NewReader(tc.answers))
+			devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer devNull.Close()
+			promptOut = devNull
+
+			conf := Config{StatePath: t.TempDir()}
+			inc, err := echoIncantation(conf, entry, tc.preset, tc.raw)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if inc.Command != tc.want {
+				t.Errorf("got %q, want %q", inc.Command, tc.want)
+			}
+		})
+	}
+}
+
+func TestAddCommand(t *testing.T) {
+	var testCases = []struct {
+		name  string
+		spell string
+
+		err error
+	}{
+		{
+			name:  "ok",
+			spell: "scp <file=a> <host>:",
+		},
+		{
+			name:  "error - parameter defaulted twice",
+			spell: "scp <file=a> <file=b>",
+
+			err: fmt.Errorf("spell copy: parameter 'file' appears multiple times with default values - defaults only allowed on first occurrence"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := Grimoire{Name: "local", Path: t.TempDir()}
+			conf := Config{SpellPath: g.Path, Grimoires: []Grimoire{g}}
+
+			err := addCommand(conf, []string{"--suggest=false", tc.spell, "copy", "Copy a file"})
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+
+			// Only a spell that can be cast is written
+			_, err = os.Stat(filepath.Join(g.Path, "copy"))
+			if written := err == nil; written != (tc.err == nil) {
+				t.Errorf("got spell written %v, want %v", written, tc.err == nil)
+			}
+		})
+	}
+}
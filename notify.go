@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultNotify is how the terminal is notified when no Notify setting is
+// given. Every terminal understands the bell, even if few show it.
+const defaultNotify = "bell"
+
+// tmuxPassthrough wraps an escape sequence so that tmux passes it through to
+// the terminal outside rather than swallowing it.
+func tmuxPassthrough(seq string) string {
+	return "\033Ptmux;" + strings.ReplaceAll(seq, "\033", "\033\033") + "\033\\"
+}
+
+// notification returns the escape sequence that asks the terminal to show a
+// notification in the given style: osc9, osc777, bell, or none.
+func notification(style, title, body string, tmux bool) (string, error) {
+	var seq string
+	switch style {
+	case "osc9":
+		seq = "\033]9;" + title + ": " + body + "\a"
+	case "osc777":
+		seq = "\033]777;notify;" + title + ";" + body + "\a"
+	case "bell":
+		// The bell doesn't need to get past tmux, which rings it itself
+		return "\a", nil
+	case "none":
+		return "", nil
+	default:
+		return "", fmt.Errorf("expected one of osc9, osc777, bell or none, got %q", style)
+	}
+
+	if tmux {
+		seq = tmuxPassthrough(seq)
+	}
+
+	return seq, nil
+}
+
+// notifyCast lets the user know that a spell has finished if it ran for at
+// least conf.NotifyAfter, by notifying the terminal and running the configured
+// notifier. Failing to notify is only a warning.
+func notifyCast(conf Config, inc *Incantation, code int, duration time.Duration) {
+	if conf.NotifyAfter <= 0 || duration < conf.NotifyAfter {
+		return
+	}
+
+	status := "finished"
+	if code != 0 {
+		status = fmt.Sprintf("failed with exit code %d", code)
+	}
+	body := fmt.Sprintf("%s %s after %s", inc.Name, status, duration.Round(time.Second))
+
+	// Background casts have no terminal to notify
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		seq, err := notification(conf.Notify, "grimoire", body, os.Getenv("TMUX") != "")
+		if err == nil {
+			_, err = fmt.Fprint(tty, seq)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: notify: %v\n", err)
+		}
+		tty.Close()
+	}
+
+	if conf.Notifier != "" {
+		if err := runHooks([]string{conf.Notifier}, hookEnv(inc, true, code, duration)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: notifier %v\n", err)
+		}
+	}
+}
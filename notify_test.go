@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestNotification(t *testing.T) {
+	var testCases = []struct {
+		name  string
+		style string
+		tmux  bool
+
+		want string
+		err  error
+	}{
+		{
+			name:  "ok - osc9",
+			style: "osc9",
+
+			want: "\033]9;grimoire: backup finished\a",
+		},
+		{
+			name:  "ok - osc777",
+			style: "osc777",
+
+			want: "\033]777;notify;grimoire;backup finished\a",
+		},
+		{
+			name:  "ok - osc9 in tmux",
+			style: "osc9",
+			tmux:  true,
+
+			want: "\033Ptmux;\033\033]9;grimoire: backup finished\a\033\\",
+		},
+		{
+			name:  "ok - bell in tmux",
+			style: "bell",
+			tmux:  true,
+
+			want: "\a",
+		},
+		{
+			name:  "ok - none",
+			style: "none",
+
+			want: "",
+		},
+		{
+			name:  "error - unknown style",
+			style: "popup",
+
+			err: fmt.Errorf(`expected one of osc9, osc777, bell or none, got "popup"`),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := notification(tc.style, "grimoire", "backup finished", tc.tmux)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -52,6 +52,7 @@ func ParseSpell(spell string) (*Spell, error) {
 	if len(matches) == 0 {
 		// No parameters, return a single segment
 		return &Spell{
+			Raw:          spell,
 			Segments:     []string{spell},
 			ParamIndices: []int{},
 			Params:       []Param{},
@@ -83,7 +84,7 @@ func ParseSpell(spell string) (*Spell, error) {
 			name, defaultValues := extractParamNameAndDefaults(spell, paramStart, paramEnd)
 
 			if _, exists := paramMap[name]; exists {
-				if len(defaultValues) > 1 {
+				if len(defaultValues) > 0 {
 					return nil, fmt.Errorf("parameter '%s' appears multiple times with default values - defaults only allowed on first occurrence", name)
 				}
 			} else {
@@ -124,6 +125,30 @@ func ParseSpell(spell string) (*Spell, error) {
 	}, nil
 }
 
+// MergeParams combines the parameters of several spells which are substituted
+// together, in order of first occurrence. Like parameters repeated within a
+// single spell, defaults are only allowed on the first occurrence.
+func MergeParams(spells ...*Spell) ([]Param, error) {
+	var params []Param
+	seen := make(map[string]bool)
+
+	for _, spell := range spells {
+		for _, param := range spell.Params {
+			if seen[param.Name] {
+				if len(param.DefaultValues) > 0 {
+					return nil, fmt.Errorf("parameter '%s' appears multiple times with default values - defaults only allowed on first occurrence", param.Name)
+				}
+				continue
+			}
+
+			seen[param.Name] = true
+			params = append(params, param)
+		}
+	}
+
+	return params, nil
+}
+
 func extractParamNameAndDefaults(spell string, paramStart, paramEnd int) (string, []string) {
 	paramText := strings.TrimSpace(spell[paramStart:paramEnd])
 	parts := strings.SplitN(paramText, "=", 2)
@@ -101,6 +101,7 @@ func TestParseSpell(t *testing.T) {
 			spell: "echo Hello World",
 
 			want: &Spell{
+				Raw:          "echo Hello World",
 				Segments:     []string{"echo Hello World"},
 				ParamIndices: []int{},
 				Params:       []Param{},
@@ -111,6 +112,7 @@ func TestParseSpell(t *testing.T) {
 			spell: "echo <name>",
 
 			want: &Spell{
+				Raw:          "echo <name>",
 				Segments:     []string{"echo ", "name"},
 				ParamIndices: []int{1},
 				Params: []Param{
@@ -123,6 +125,7 @@ func TestParseSpell(t *testing.T) {
 			spell: "echo <name=World>",
 
 			want: &Spell{
+				Raw:          "echo <name=World>",
 				Segments:     []string{"echo ", "name"},
 				ParamIndices: []int{1},
 				Params: []Param{
@@ -135,6 +138,7 @@ func TestParseSpell(t *testing.T) {
 			spell: "cp <source=file.txt> <destination=backup.txt>",
 
 			want: &Spell{
+				Raw:          "cp <source=file.txt> <destination=backup.txt>",
 				Segments:     []string{"cp ", "source", " ", "destination"},
 				ParamIndices: []int{1, 3},
 				Params: []Param{
@@ -148,6 +152,7 @@ func TestParseSpell(t *testing.T) {
 			spell: "mv <oldname=file1.txt;file_old.txt> <newname=file2.txt;file_new.txt>",
 
 			want: &Spell{
+				Raw:          "mv <oldname=file1.txt;file_old.txt> <newname=file2.txt;file_new.txt>",
 				Segments:     []string{"mv ", "oldname", " ", "newname"},
 				ParamIndices: []int{1, 3},
 				Params: []Param{
@@ -161,6 +166,7 @@ func TestParseSpell(t *testing.T) {
 			spell: "echo <name> and again <name>",
 
 			want: &Spell{
+				Raw:          "echo <name> and again <name>",
 				Segments:     []string{"echo ", "name", " and again ", "name"},
 				ParamIndices: []int{1, 3},
 				Params: []Param{
@@ -173,6 +179,7 @@ func TestParseSpell(t *testing.T) {
 			spell: "echo <name=World> and again <name>",
 
 			want: &Spell{
+				Raw:          "echo <name=World> and again <name>",
 				Segments:     []string{"echo ", "name", " and again ", "name"},
 				ParamIndices: []int{1, 3},
 				Params: []Param{
@@ -185,6 +192,7 @@ func TestParseSpell(t *testing.T) {
 			spell: "echo <name> trailing segment test",
 
 			want: &Spell{
+				Raw:          "echo <name> trailing segment test",
 				Segments:     []string{"echo ", "name", " trailing segment test"},
 				ParamIndices: []int{1},
 				Params: []Param{
@@ -218,3 +226,63 @@ func TestParseSpell(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeParams(t *testing.T) {
+	var testCases = []struct {
+		name   string
+		spells []string
+
+		want []Param
+		err  error
+	}{
+		{
+			name:   "ok - no parameters",
+			spells: []string{"echo Hello World", "/tmp"},
+
+			want: nil,
+		},
+		{
+			name:   "ok - parameters in order of first occurrence",
+			spells: []string{"kubectl -n <namespace=default> get <kind>", "<kubeconfig=~/.kube/config>", "<namespace>"},
+
+			want: []Param{
+				{Name: "namespace", DefaultValues: []string{"default"}},
+				{Name: "kind", DefaultValues: nil},
+				{Name: "kubeconfig", DefaultValues: []string{"~/.kube/config"}},
+			},
+		},
+		{
+			name:   "error - defaults on repeated parameter",
+			spells: []string{"cd <dir>", "<dir=/tmp>"},
+
+			err: fmt.Errorf("parameter 'dir' appears multiple times with default values - defaults only allowed on first occurrence"),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var spells []*Spell
+			for _, text := range tc.spells {
+				spell, err := ParseSpell(text)
+				if err != nil {
+					t.Fatalf("unexpected error parsing %q: %v", text, err)
+				}
+				spells = append(spells, spell)
+			}
+
+			result, err := MergeParams(spells...)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+		})
+	}
+}
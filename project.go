@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// projectDir is the directory that holds a project's own spells, found in the
+// project's root directory.
+const projectDir = ".grimoire"
+
+// findProject walks up from dir looking for a project's spells, returning the
+// root of the project if there is one.
+func findProject(dir string) (string, bool) {
+	for {
+		if info, err := os.Stat(filepath.Join(dir, projectDir)); err == nil && info.IsDir() {
+			return dir, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// projectGrimoire returns the grimoire of the project rooted at root, named
+// after the project's directory.
+func projectGrimoire(root string) Grimoire {
+	return Grimoire{
+		Name: filepath.Base(root),
+		Path: filepath.Join(root, projectDir),
+		Root: root,
+	}
+}
+
+// localGrimoire returns the grimoire of the project that grimoire is being
+// run in.
+func localGrimoire(conf Config) (Grimoire, error) {
+	for _, g := range conf.Grimoires {
+		if g.Root != "" {
+			return g, nil
+		}
+	}
+
+	cwd, _ := os.Getwd()
+	return Grimoire{}, fmt.Errorf("no %s directory in %s or its parents, create one in the project's root first", projectDir, cwd)
+}
+
+// readSpellRef reads the spell that ref refers to. The name of a spell in a
+// book is qualified with the book, such as k8s/pods. Spells from a project are
+// cast from the project's root, or from their Dir relative to it once its
+// parameters are filled in.
+func readSpellRef(ref spellRef) (Entry, error) {
+	entry, err := readSpell(ref.Grimoire.Path, ref.Name)
+	if err != nil {
+		return entry, err
+	}
+
+	// A spell without a Name header is known by its file, so that it still
+	// has a name to be confirmed and recorded with
+	if entry.Name == "" {
+		entry.Name = ref.Name
+	} else if ref.Book() != "" {
+		entry.Name = path.Join(ref.Book(), entry.Name)
+	}
+
+	entry.Root = ref.Grimoire.Root
+	entry.Ref = ref.String()
+
+	return entry, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindProject(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, projectDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "src", "cmd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{root, filepath.Join(root, "src", "cmd")} {
+		got, ok := findProject(dir)
+		if !ok || got != root {
+			t.Errorf("findProject(%s) = %s, %v, want %s", dir, got, ok, root)
+		}
+	}
+
+	if got, ok := findProject(t.TempDir()); ok {
+		t.Errorf("found project %s where there is none", got)
+	}
+}
+
+func TestReadSpellRef(t *testing.T) {
+	root := t.TempDir()
+	g := projectGrimoire(root)
+	if err := os.MkdirAll(g.Path, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name   string
+		header string
+		values map[string]string
+
+		want string
+	}{
+		{
+			name: "project root",
+
+			want: root,
+		},
+		{
+			name:   "relative to project root",
+			header: "\nDir: web/<app>",
+			values: map[string]string{"app": "shop"},
+
+			want: filepath.Join(root, "web/shop"),
+		},
+		{
+			name:   "absolute",
+			header: "\nDir: /tmp",
+
+			want: "/tmp",
+		},
+		{
+			name:   "absolute parameter",
+			header: "\nDir: <dir>",
+			values: map[string]string{"dir": "/var/log"},
+
+			want: "/var/log",
+		},
+		{
+			name:   "home",
+			header: "\nDir: ~/src",
+
+			want: filepath.Join(home, "src"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			contents := "Spell: make build\nName: build" + tc.header + "\n"
+			if err := os.WriteFile(filepath.Join(g.Path, "build"), []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			entry, err := readSpellRef(spellRef{Name: "build", Grimoire: g})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			template, err := parseTemplate(entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			inc, err := template.Incantation(Config{}, entry, tc.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if inc.Dir != tc.want {
+				t.Errorf("got dir %q, want %q", inc.Dir, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadSpellRefName(t *testing.T) {
+	g := Grimoire{Name: "local", Path: t.TempDir()}
+	if err := os.MkdirAll(filepath.Join(g.Path, "k8s"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name     string
+		contents string
+
+		want string
+	}{
+		{
+			name:     "name header",
+			contents: "Spell: kubectl get pods\nName: pods\n",
+
+			want: "k8s/pods",
+		},
+		{
+			name:     "no name header",
+			contents: "Spell: kubectl delete pods --all\n",
+
+			want: "k8s/wipe",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(g.Path, "k8s", "wipe"), []byte(tc.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			entry, err := readSpellRef(spellRef{Name: "k8s/wipe", Grimoire: g})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if entry.Name != tc.want {
+				t.Errorf("got name %q, want %q", entry.Name, tc.want)
+			}
+		})
+	}
+}
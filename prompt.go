@@ -9,15 +9,44 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"unicode"
+	"unicode/utf8"
 )
 
+// promptIn and promptOut are the terminal that prompts are shown on. They are
+// stdin and stdout unless stdout is needed for output, see usePromptTTY.
+var (
+	promptIn  = os.Stdin
+	promptOut = os.Stdout
+)
+
+// input reads lines typed in response to prompts. It is shared by every prompt
+// so that lines buffered while reading one answer aren't lost to the next.
+var input = bufio.NewScanner(promptIn)
+
+// usePromptTTY shows prompts on the controlling terminal rather than stdin and
+// stdout, which leaves stdout free for output that is captured by the caller,
+// such as in $(grimoire echo). If there is no terminal, prompts are read from
+// stdin and shown on stderr instead.
+func usePromptTTY() {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		promptOut = os.Stderr
+		return
+	}
+
+	promptIn = tty
+	promptOut = tty
+	input = bufio.NewScanner(promptIn)
+}
+
 // setRawMode sets the terminal to raw mode to capture individual keystrokes.
 // Note: It would be better to use a go-native solution here rather than running
 // a sub-process to call stty for us.
 func setRawMode() error {
-	fmt.Print("\033[?25l")
+	fmt.Fprint(promptOut, "\033[?25l")
 	cmd := exec.Command("stty", "-echo", "cbreak")
-	cmd.Stdin = os.Stdin
+	cmd.Stdin = promptIn
 	return cmd.Run()
 }
 
@@ -25,18 +54,16 @@ func setRawMode() error {
 // Note: It would be better to use a go-native solution here rather than running
 // a sub-process to call stty for us.
 func restoreTerminal() {
-	fmt.Print("\033[?25h")
+	fmt.Fprint(promptOut, "\033[?25h")
 	cmd := exec.Command("stty", "echo", "-cbreak")
-	cmd.Stdin = os.Stdin
+	cmd.Stdin = promptIn
 	cmd.Run()
 }
 
-// promptWithTabCycling allows the user to cycle through options using the tab key
-func promptWithTabCycling(options []string) (string, error) {
-	if len(options) == 0 {
-		return "", errors.New("no options provided")
-	}
-
+// enterRawMode puts the terminal into raw mode and returns a function that
+// restores it. The terminal is also restored if the user presses Ctrl+C in the
+// meantime, before exiting.
+func enterRawMode() (func(), error) {
 	done := make(chan struct{})
 
 	// Set up signal handling to ensure cursor is restored on Ctrl+C
@@ -53,16 +80,37 @@ func promptWithTabCycling(options []string) (string, error) {
 		}
 	}()
 
-	defer func() {
+	restore := func() {
+		signal.Stop(c)
 		done <- struct{}{}
 		close(c)
 		restoreTerminal()
-	}()
+	}
 
 	// Set terminal to raw mode to capture individual keystrokes and hide the cursor
 	if err := setRawMode(); err != nil {
+		restore()
+		return nil, err
+	}
+
+	return restore, nil
+}
+
+// rawMode puts the terminal into raw mode for the prompts that read single
+// keystrokes. Tests replace it to type into a pipe, which has no raw mode.
+var rawMode = enterRawMode
+
+// promptWithTabCycling allows the user to cycle through options using the tab key
+func promptWithTabCycling(options []string) (string, error) {
+	if len(options) == 0 {
+		return "", errors.New("no options provided")
+	}
+
+	restore, err := rawMode()
+	if err != nil {
 		return "", err
 	}
+	defer restore()
 
 	currentIndex := 0
 
@@ -81,12 +129,12 @@ func promptWithTabCycling(options []string) (string, error) {
 		return strings.Join(result, "|")
 	}
 
-	fmt.Println("Use <tab> to select:")
-	fmt.Printf("%s", fmtOpts(options))
+	fmt.Fprintln(promptOut, "Use <tab> to select:")
+	fmt.Fprintf(promptOut, "%s", fmtOpts(options))
 
 	for {
 		buf := make([]byte, 1)
-		_, err := os.Stdin.Read(buf)
+		_, err := promptIn.Read(buf)
 		if err != nil {
 			return "", err
 		}
@@ -94,12 +142,12 @@ func promptWithTabCycling(options []string) (string, error) {
 		switch buf[0] {
 		case '\t': // Tab key
 			// Clear current line and move to next option
-			fmt.Print("\r\033[K") // Clear line
+			fmt.Fprint(promptOut, "\r\033[K") // Clear line
 			currentIndex = (currentIndex + 1) % len(options)
-			fmt.Printf("%s", fmtOpts(options))
+			fmt.Fprintf(promptOut, "%s", fmtOpts(options))
 		case '\r', '\n': // Enter key
 			// Accept the current selection and return it to the caller
-			fmt.Println() // New line
+			fmt.Fprintln(promptOut) // New line
 			return options[currentIndex], nil
 		case 27: // Escape or start of escape sequence
 			// Handle potential escape sequences here in the future,
@@ -113,15 +161,14 @@ func promptWithTabCycling(options []string) (string, error) {
 }
 
 func promptSpell(args []string) (Entry, error) {
-	reader := bufio.NewScanner(os.Stdin)
+	reader := input
 
 	// Parse arguments
 	var entry Entry
 	switch len(args) {
 	case 0:
-		reader.Buffer([]byte(entry.Spell), bufio.MaxScanTokenSize)
 		// No arguments provided, prompt for both spell and name
-		fmt.Print("Spell>")
+		fmt.Fprint(promptOut, "Spell>")
 		if reader.Scan() {
 			input := strings.TrimSpace(reader.Text())
 			if input != "" {
@@ -132,7 +179,7 @@ func promptSpell(args []string) (Entry, error) {
 			return entry, errors.New("command cannot be empty")
 		}
 
-		fmt.Print("Name>")
+		fmt.Fprint(promptOut, "Name>")
 		if reader.Scan() {
 			input := strings.TrimSpace(reader.Text())
 			if input != "" {
@@ -143,7 +190,7 @@ func promptSpell(args []string) (Entry, error) {
 			return entry, errors.New("name cannot be empty")
 		}
 
-		fmt.Print("Description>")
+		fmt.Fprint(promptOut, "Description>")
 		if reader.Scan() {
 			input := strings.TrimSpace(reader.Text())
 			if input != "" {
@@ -154,7 +201,7 @@ func promptSpell(args []string) (Entry, error) {
 		// One argument provided, assume it's the spell, prompt for name
 		entry.Spell = args[0]
 
-		fmt.Print("Name>")
+		fmt.Fprint(promptOut, "Name>")
 		if reader.Scan() {
 			input := strings.TrimSpace(reader.Text())
 			if input != "" {
@@ -165,7 +212,7 @@ func promptSpell(args []string) (Entry, error) {
 			return entry, errors.New("name cannot be empty")
 		}
 
-		fmt.Print("Description>")
+		fmt.Fprint(promptOut, "Description>")
 		if reader.Scan() {
 			input := strings.TrimSpace(reader.Text())
 			if input != "" {
@@ -179,7 +226,7 @@ func promptSpell(args []string) (Entry, error) {
 		entry.Spell = args[0]
 		entry.Name = args[1]
 
-		fmt.Print("Description>")
+		fmt.Fprint(promptOut, "Description>")
 		if reader.Scan() {
 			input := strings.TrimSpace(reader.Text())
 			if input != "" {
@@ -192,7 +239,7 @@ func promptSpell(args []string) (Entry, error) {
 		entry.Desc = args[2]
 
 	default:
-		return entry, errors.New("too many arguments")
+		return entry, usageErrorf("too many arguments")
 	}
 
 	if err := reader.Err(); err != nil {
@@ -202,38 +249,170 @@ func promptSpell(args []string) (Entry, error) {
 	return entry, nil
 }
 
-// promptSpellParameters uses shell prompts to substitute parameters in a spell.
-func promptSpellParameters(spell *Spell) (string, error) {
-	fmt.Printf("Casting: %s\n", spell.Raw)
-
+// promptSpellParameters uses shell prompts to get a value for each parameter.
+// Parameters found in the active context, if any, are pre-filled with the
+// context's value so that only an empty input is needed to accept it.
+func promptSpellParameters(params []Param, ctx *Context) (map[string]string, error) {
 	// Prompt user for parameters
 	paramValues := make(map[string]string)
-	reader := bufio.NewScanner(os.Stdin)
-	for _, param := range spell.Params {
+	reader := input
+	for _, param := range params {
+		prefill, fromContext := "", false
+		if ctx != nil {
+			prefill, fromContext = ctx.Values[param.Name]
+		}
+
 		prompt := fmt.Sprintf("Substitute <%s>", param.Name)
-		if len(param.DefaultValues) > 0 {
+		if fromContext {
+			prompt += fmt.Sprintf(" (context %s: %s)", ctx.Name, prefill)
+		} else if len(param.DefaultValues) > 0 {
 			prompt += fmt.Sprintf(" (default: %s)", strings.Join(param.DefaultValues, ", "))
+			prefill = param.DefaultValues[0]
 		}
 		prompt += ": "
 
-		fmt.Print(prompt)
+		fmt.Fprint(promptOut, prompt)
 		if reader.Scan() {
 			input := strings.TrimSpace(reader.Text())
 			if input != "" {
 				paramValues[param.Name] = input
 			}
-			// If input is empty and there are default values, use the first default
-			if input == "" && len(param.DefaultValues) > 0 {
-				paramValues[param.Name] = param.DefaultValues[0]
+			// If input is empty, use the context value or the first default
+			if input == "" && (fromContext || len(param.DefaultValues) > 0) {
+				paramValues[param.Name] = prefill
 			}
 		}
 
 	}
 
 	if err := reader.Err(); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// Reconstruct the spell with provided parameters
-	return spell.Substitute(paramValues)
+	return paramValues, nil
+}
+
+// editLine lets the user edit text in place on a single line, starting with
+// the cursor at the end. Enter accepts the edited text, and escape cancels,
+// in which case false is returned.
+func editLine(prompt, text string) (string, bool, error) {
+	restore, err := rawMode()
+	if err != nil {
+		return "", false, err
+	}
+	defer restore()
+
+	// The cursor is hidden by raw mode, but we need it to see where we're typing
+	fmt.Fprint(promptOut, "\033[?25h")
+
+	line := []rune(text)
+	cursor := len(line)
+
+	redraw := func() {
+		fmt.Fprintf(promptOut, "\r\033[K%s%s", prompt, string(line))
+		if back := len(line) - cursor; back > 0 {
+			fmt.Fprintf(promptOut, "\033[%dD", back)
+		}
+	}
+	redraw()
+
+	for {
+		buf := make([]byte, 64)
+		n, err := promptIn.Read(buf)
+		if err != nil {
+			return "", false, err
+		}
+		buf = buf[:n]
+
+		// Escape on its own, rather than as the start of a key sequence
+		if len(buf) == 1 && buf[0] == 27 {
+			fmt.Fprintln(promptOut)
+			return "", false, nil
+		}
+
+		// Several keys may arrive in one read when typing quickly or pasting
+		for len(buf) > 0 {
+			size := 1
+
+			switch {
+			case buf[0] == 27: // Escape sequence
+				if len(buf) >= 3 && buf[1] == '[' {
+					size = 3
+					switch buf[2] {
+					case 'D': // Left arrow
+						if cursor > 0 {
+							cursor--
+						}
+					case 'C': // Right arrow
+						if cursor < len(line) {
+							cursor++
+						}
+					case 'H': // Home
+						cursor = 0
+					case 'F': // End
+						cursor = len(line)
+					}
+				}
+			case buf[0] == '\r' || buf[0] == '\n': // Enter key
+				fmt.Fprintln(promptOut)
+				return string(line), true, nil
+			case buf[0] == 127 || buf[0] == 8: // Backspace
+				if cursor > 0 {
+					line = append(line[:cursor-1], line[cursor:]...)
+					cursor--
+				}
+			case buf[0] == 1: // Ctrl+A
+				cursor = 0
+			case buf[0] == 5: // Ctrl+E
+				cursor = len(line)
+			case buf[0] == 11: // Ctrl+K
+				line = line[:cursor]
+			case buf[0] == 21: // Ctrl+U
+				line = line[cursor:]
+				cursor = 0
+			default:
+				// Insert typed text, ignoring any other control keys
+				var r rune
+				r, size = utf8.DecodeRune(buf)
+				if unicode.IsPrint(r) {
+					line = append(line[:cursor], append([]rune{r}, line[cursor:]...)...)
+					cursor++
+				}
+			}
+
+			buf = buf[size:]
+		}
+
+		redraw()
+	}
+}
+
+// confirmCast shows the final command that is about to be cast and lets the
+// user cast it, edit it first, or cancel. It returns the command to cast and
+// false if the cast was cancelled.
+func confirmCast(command string) (string, bool, error) {
+	for {
+		fmt.Fprintf(promptOut, "%s\n", command)
+
+		action, err := choose([]string{"cast", "edit", "cancel"})
+		if err != nil {
+			return "", false, err
+		}
+
+		switch action {
+		case "cast":
+			return command, true, nil
+		case "edit":
+			edited, ok, err := editLine("> ", command)
+			if err != nil {
+				return "", false, err
+			}
+			if ok {
+				command = edited
+			}
+		default:
+			// The user cancelled, either explicitly or with escape
+			return "", false, nil
+		}
+	}
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+// typeKeys feeds keys to the prompts through a pipe, as if they were typed,
+// and hides what the prompts show, until the test ends.
+func typeKeys(t *testing.T, keys string) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteString(keys); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldIn, oldOut, oldRawMode := promptIn, promptOut, rawMode
+	t.Cleanup(func() {
+		promptIn, promptOut, rawMode = oldIn, oldOut, oldRawMode
+		r.Close()
+		devNull.Close()
+	})
+	promptIn, promptOut = r, devNull
+	rawMode = func() (func(), error) { return func() {}, nil }
+}
+
+func TestEditLine(t *testing.T) {
+	var testCases = []struct {
+		name string
+		text string
+		keys string
+
+		want   string
+		wantOK bool
+		err    error
+	}{
+		{
+			name: "ok - accepted as it was",
+			text: "ls",
+			keys: "\r",
+
+			want:   "ls",
+			wantOK: true,
+		},
+		{
+			name: "ok - typed at the end",
+			text: "ls",
+			keys: " -la\n",
+
+			want:   "ls -la",
+			wantOK: true,
+		},
+		{
+			name: "ok - arrows and backspace",
+			text: "ls -la",
+			keys: "\x1b[D\x1b[D\x1b[D\x7fh\x1b[C\x1b[Cx\r",
+
+			want:   "lsh-lxa",
+			wantOK: true,
+		},
+		{
+			name: "ok - home and end",
+			text: "ls",
+			keys: "\x1b[Hsudo \x1b[F /root\r",
+
+			want:   "sudo ls /root",
+			wantOK: true,
+		},
+		{
+			name: "ok - ctrl+a and ctrl+k",
+			text: "ls -la",
+			keys: "\x01\x0bpwd\r",
+
+			want:   "pwd",
+			wantOK: true,
+		},
+		{
+			name: "ok - ctrl+u and ctrl+e",
+			text: "cd /tmp; ls",
+			keys: "\x1b[D\x1b[D\x15\x05 -la\r",
+
+			want:   "ls -la",
+			wantOK: true,
+		},
+		{
+			name: "ok - other control keys ignored",
+			text: "echo ",
+			keys: "caf\x02é\r",
+
+			want:   "echo café",
+			wantOK: true,
+		},
+		{
+			name: "ok - cancelled with escape",
+			text: "ls",
+			keys: "\x1b",
+
+			want:   "",
+			wantOK: false,
+		},
+		{
+			name: "error - input closed",
+			text: "ls",
+			keys: " -la",
+
+			err: io.EOF,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			typeKeys(t, tc.keys)
+
+			got, ok, err := editLine("> ", tc.text)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("got %q, %v, want %q, %v", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestConfirmCast(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		actions []string
+		keys    string
+
+		want   string
+		wantOK bool
+	}{
+		{
+			name:    "cast",
+			actions: []string{"cast"},
+
+			want:   "make deploy",
+			wantOK: true,
+		},
+		{
+			name:    "edited then cast",
+			actions: []string{"edit", "cast"},
+			keys:    " STAGE=dev\r",
+
+			want:   "make deploy STAGE=dev",
+			wantOK: true,
+		},
+		{
+			name:    "edit cancelled then cast",
+			actions: []string{"edit", "cast"},
+			keys:    "\x1b",
+
+			want:   "make deploy",
+			wantOK: true,
+		},
+		{
+			name:    "cancelled",
+			actions: []string{"cancel"},
+
+			want:   "",
+			wantOK: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			typeKeys(t, tc.keys)
+
+			actions := tc.actions
+			t.Cleanup(func() { choose = promptWithTabCycling })
+			choose = func(options []string) (string, error) {
+				action := actions[0]
+				actions = actions[1:]
+				return action, nil
+			}
+
+			got, ok, err := confirmCast("make deploy")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("got %q, %v, want %q, %v", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// setSpellName changes the Name header of a spell file's contents, adding one
+// if there isn't one, and leaves every other line as it was.
+func setSpellName(contents, name string) string {
+	lines := strings.SplitAfter(contents, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "Name:") {
+			lines[i] = "Name: " + name + "\n"
+			return strings.Join(lines, "")
+		}
+	}
+
+	if contents != "" && !strings.HasSuffix(contents, "\n") {
+		contents += "\n"
+	}
+	return contents + "Name: " + name + "\n"
+}
+
+// moveSpellState moves what grimoire keeps about a spell, its history and any
+// runbook progress, from where it was to where it is now so that it can still
+// be recast and resumed. name is the name the spell was cast under before.
+// Background jobs keep the name they were cast under.
+func moveSpellState(statePath, name string, from, to spellRef) error {
+	renamed := spellName(to)
+
+	err := os.Rename(runbookProgressPath(statePath, name), runbookProgressPath(statePath, renamed))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return rewriteHistory(statePath, func(record *Record) bool {
+		// Records without a ref predate it, and only have the name to go by
+		if record.Ref != from.String() && (record.Ref != "" || record.Name != name) {
+			return false
+		}
+		record.Name = renamed
+		record.Ref = to.String()
+		return true
+	})
+}
+
+// spellName returns the name a spell is cast and recorded under, which is
+// that of its file if its Name header can't be read.
+func spellName(ref spellRef) string {
+	entry, err := readSpellRef(ref)
+	if err != nil {
+		return ref.Name
+	}
+	return entry.Name
+}
+
+// writeSpellAs writes the contents of a spell under a new name, which must
+// not be taken yet, returning where it was written.
+func writeSpellAs(contents string, g Grimoire, book, name string) (spellRef, error) {
+	if err := checkSpellName(name); err != nil {
+		return spellRef{}, err
+	}
+
+	to := spellRef{Name: path.Join(book, name), Grimoire: g}
+	if _, err := os.Stat(to.Path()); err == nil {
+		return to, fmt.Errorf("spell %s already exists", to.Name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to.Path()), 0755); err != nil {
+		return to, err
+	}
+
+	return to, os.WriteFile(to.Path(), []byte(setSpellName(contents, name)), 0644)
+}
+
+// renameSpell renames a spell within its book, changing both its file and
+// its Name header, along with its history and any runbook progress.
+func renameSpell(statePath string, ref spellRef, name string) (spellRef, error) {
+	contents, err := os.ReadFile(ref.Path())
+	if err != nil {
+		return ref, err
+	}
+
+	from := spellName(ref)
+
+	renamed, err := writeSpellAs(string(contents), ref.Grimoire, ref.Book(), name)
+	if err != nil {
+		return ref, err
+	}
+
+	if err := os.Remove(ref.Path()); err != nil {
+		return renamed, err
+	}
+
+	return renamed, moveSpellState(statePath, from, ref, renamed)
+}
+
+func renameCommand(conf Config, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return usageErrorf("usage: rename [spell] <new-name>")
+	}
+
+	ref, err := selectSpell(conf, "", args[:len(args)-1])
+	if err != nil {
+		return err
+	}
+
+	if err := checkWritable(ref, "rename"); err != nil {
+		return err
+	}
+
+	name := args[len(args)-1]
+	if name == path.Base(ref.Name) {
+		return nil
+	}
+
+	renamed, err := renameSpell(conf.StatePath, ref, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s renamed to %s\n", ref.Name, renamed.Name)
+
+	autoCommit(conf, ref.Grimoire, fmt.Sprintf("Rename spell %s to %s", ref.Name, renamed.Name), ref.Name, renamed.Name)
+
+	return nil
+}
+
+// cloneCommand copies a spell under a new name, in the same book, and opens
+// the copy for editing. A spell from a read-only grimoire is cloned into the
+// grimoire new spells are added to.
+func cloneCommand(conf Config, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return usageErrorf("usage: clone [spell] <new-name>")
+	}
+
+	ref, err := selectSpell(conf, "", args[:len(args)-1])
+	if err != nil {
+		return err
+	}
+
+	g := ref.Grimoire
+	if g.ReadOnly {
+		g, err = spellPathGrimoire(conf)
+		if err != nil {
+			return err
+		}
+	}
+
+	contents, err := os.ReadFile(ref.Path())
+	if err != nil {
+		return err
+	}
+
+	clone, err := writeSpellAs(string(contents), g, ref.Book(), args[len(args)-1])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s cloned as %s\n", ref.Name, clone.Name)
+
+	// The clone is kept even if editing it is abandoned
+	edited, err := editSpell(spellEditor(conf), clone)
+	if err == nil && edited != clone {
+		fmt.Printf("%s renamed to %s\n", clone.Name, edited.Name)
+	}
+
+	autoCommit(conf, g, fmt.Sprintf("Clone spell %s as %s", ref.Name, edited.Name), edited.Name)
+
+	return err
+}
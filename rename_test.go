@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestSetSpellName(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		contents string
+
+		want string
+	}{
+		{
+			name:     "replaces the header",
+			contents: "# Lists pods\nSpell: kubectl get pods\nName: pods\nDescription: List pods\n",
+
+			want: "# Lists pods\nSpell: kubectl get pods\nName: list-pods\nDescription: List pods\n",
+		},
+		{
+			name:     "last line",
+			contents: "Spell: kubectl get pods\nName: pods",
+
+			want: "Spell: kubectl get pods\nName: list-pods\n",
+		},
+		{
+			name:     "no header",
+			contents: "Spell: kubectl get pods",
+
+			want: "Spell: kubectl get pods\nName: list-pods\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := setSpellName(tc.contents, "list-pods")
+			if got != tc.want {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", got, tc.want, test.Diff(got, tc.want))
+			}
+		})
+	}
+}
+
+func TestRenameSpell(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		newName string
+
+		want string
+		err  error
+	}{
+		{
+			name:    "renamed",
+			newName: "rollout",
+
+			want: "k8s/rollout",
+		},
+		{
+			name:    "taken",
+			newName: "pods",
+
+			err: fmt.Errorf("spell k8s/pods already exists"),
+		},
+		{
+			name:    "into a book",
+			newName: "ops/rollout",
+
+			err: fmt.Errorf("invalid name ops/rollout, use move to put a spell in a book"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := Grimoire{Name: "local", Path: t.TempDir()}
+			statePath := t.TempDir()
+			for _, name := range []string{"deploy", "pods"} {
+				if err := writeSpell(filepath.Join(g.Path, "k8s"), Entry{Spell: "kubectl", Name: name}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writeRunbookProgress(statePath, "k8s/deploy", runbookProgress{Step: 2}); err != nil {
+				t.Fatal(err)
+			}
+			// The first record predates refs, and the last is of a spell of the
+			// same name in another grimoire
+			history := []Record{
+				{Name: "k8s/deploy"},
+				{Name: "k8s/pods", Ref: "local:k8s/pods"},
+				{Name: "k8s/deploy", Ref: "local:k8s/deploy"},
+				{Name: "k8s/deploy", Ref: "shared:k8s/deploy"},
+			}
+			for _, record := range history {
+				if err := appendHistory(statePath, record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := renameSpell(statePath, spellRef{Name: "k8s/deploy", Grimoire: g}, tc.newName)
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if tc.err != nil {
+				return
+			}
+
+			if got.Name != tc.want {
+				t.Errorf("got %s, want %s", got.Name, tc.want)
+			}
+
+			entry, err := readSpellRef(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Name != tc.want {
+				t.Errorf("got Name header %s, want %s", entry.Name, tc.want)
+			}
+
+			if _, err := os.Stat(filepath.Join(g.Path, "k8s", "deploy")); err == nil {
+				t.Errorf("old spell file was left behind")
+			}
+
+			progress, err := readRunbookProgress(statePath, tc.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if progress == nil || progress.Step != 2 {
+				t.Errorf("got runbook progress %v, want it moved to %s", progress, tc.want)
+			}
+
+			records, err := readHistory(statePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var refs []string
+			for _, record := range records {
+				refs = append(refs, record.Ref+" "+record.Name)
+			}
+			want := []string{
+				"local:" + tc.want + " " + tc.want,
+				"local:k8s/pods k8s/pods",
+				"local:" + tc.want + " " + tc.want,
+				"shared:k8s/deploy k8s/deploy",
+			}
+			if !reflect.DeepEqual(refs, want) {
+				t.Errorf("got history of %v, want %v", refs, want)
+			}
+		})
+	}
+}
+
+func TestCloneCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	// The editor either leaves the clone as it is, or breaks it and then
+	// gives up once told what is wrong
+	var editors = map[string]string{
+		"unchanged": "#!/bin/sh\nexit 0\n",
+		"abandoned": "#!/bin/sh\ngrep -q '^#! ' \"$1\" || printf 'Spel: ls\\nName: list\\n' > \"$1\"\n",
+	}
+	for name, script := range editors {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var testCases = []struct {
+		name     string
+		editor   string
+		readOnly bool
+
+		err error
+	}{
+		{
+			name:   "same grimoire",
+			editor: "unchanged",
+		},
+		{
+			name:     "from a read-only grimoire",
+			editor:   "unchanged",
+			readOnly: true,
+		},
+		{
+			name:   "edit abandoned",
+			editor: "abandoned",
+
+			err: fmt.Errorf(`spell tools/list not saved: unknown header "Spel"; spell list has no incantation`),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			local := Grimoire{Name: "local", Path: t.TempDir()}
+			shared := Grimoire{Name: "shared", Path: t.TempDir(), ReadOnly: tc.readOnly}
+
+			from := local
+			if tc.readOnly {
+				from = shared
+			}
+			if err := writeSpell(filepath.Join(from.Path, "tools"), Entry{Spell: "ls -la", Name: "ls"}); err != nil {
+				t.Fatal(err)
+			}
+
+			conf := Config{
+				SpellPath: local.Path,
+				Grimoires: []Grimoire{local, shared},
+				Editor:    filepath.Join(dir, tc.editor),
+				StatePath: t.TempDir(),
+			}
+
+			err := cloneCommand(conf, []string{from.Name + ":tools/ls", "list"})
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+
+			// The clone is kept as it was copied, even when the edit is
+			// abandoned
+			ref, err := lookupSpell(conf.Grimoires, "", "tools/list")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ref.Grimoire.Name != local.Name {
+				t.Errorf("got clone in grimoire %s, want %s", ref.Grimoire.Name, local.Name)
+			}
+
+			entry, err := readSpellRef(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Spell != "ls -la" || entry.Name != "tools/list" {
+				t.Errorf("got clone %s: %s, want tools/list: ls -la", entry.Name, entry.Spell)
+			}
+
+			if _, err := os.Stat(filepath.Join(from.Path, "tools", "ls")); err != nil {
+				t.Errorf("original spell is gone: %v", err)
+			}
+		})
+	}
+}
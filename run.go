@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// foregroundGroup returns the process group in the foreground of the terminal
+// open as fd, or an error if fd isn't a terminal.
+func foregroundGroup(fd uintptr) (int, error) {
+	var pgrp int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(pgrp), nil
+}
+
+// setForegroundGroup puts the process group pgrp in the foreground of the
+// terminal open as fd.
+func setForegroundGroup(fd uintptr, pgrp int) error {
+	// A background process changing the foreground group is sent SIGTTOU,
+	// which would otherwise stop grimoire.
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	p := int32(pgrp)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCSPGRP, uintptr(unsafe.Pointer(&p)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// exitTimedOut is the exit code of a command that was killed for running past
+// its timeout, the same as used by timeout(1).
+const exitTimedOut = 124
+
+// timeoutGrace is how long a command has to exit after being sent SIGTERM for
+// running past its timeout before it is killed.
+const timeoutGrace = 5 * time.Second
+
+// runCommand runs cmd in its own process group and returns its exit code, or
+// 128 plus the signal number if it was killed by a signal. SIGINT, SIGTERM and
+// SIGWINCH received by grimoire are forwarded to the process group. When cmd
+// is attached to the terminal grimoire is in the foreground of, cmd is put in
+// the foreground in its place until it exits.
+//
+// If timeout is non-zero, the process group is sent SIGTERM once it has run
+// that long, followed by SIGKILL if it still hasn't exited after a grace
+// period, and exitTimedOut is returned along with true. A command that has
+// already been waited for when the timeout passes isn't counted as timed out.
+func runCommand(cmd *exec.Cmd, timeout time.Duration) (int, bool, error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	foreground := false
+	if cmd.Stdin == os.Stdin {
+		pgrp, err := foregroundGroup(os.Stdin.Fd())
+		foreground = err == nil && pgrp == syscall.Getpgrp()
+	}
+	if foreground {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = 0 // The child's stdin
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGWINCH)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+
+	if err := cmd.Start(); err != nil {
+		return 0, false, err
+	}
+
+	go func() {
+		for sig := range signals {
+			syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+		}
+	}()
+
+	// Once cmd has been waited for, its process group ID may be reused, so
+	// the timers only signal it while exited is false
+	var mu sync.Mutex
+	exited, timedOut := false, false
+	if timeout > 0 {
+		term := time.AfterFunc(timeout, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if !exited && syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM) == nil {
+				timedOut = true
+			}
+		})
+		defer term.Stop()
+
+		kill := time.AfterFunc(timeout+timeoutGrace, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if !exited {
+				syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			}
+		})
+		defer kill.Stop()
+	}
+
+	err := cmd.Wait()
+
+	mu.Lock()
+	exited = true
+	mu.Unlock()
+
+	if foreground {
+		setForegroundGroup(os.Stdin.Fd(), syscall.Getpgrp())
+	}
+
+	if timedOut {
+		return exitTimedOut, true, nil
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return 0, false, err
+		}
+
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), false, nil
+		}
+		return exitErr.ExitCode(), false, nil
+	}
+
+	return 0, false, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunCommand(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		script  string
+		timeout time.Duration
+
+		want         int
+		wantTimedOut bool
+	}{
+		{
+			name:   "success",
+			script: "true",
+
+			want: 0,
+		},
+		{
+			name:   "exit code",
+			script: "exit 3",
+
+			want: 3,
+		},
+		{
+			name:   "killed by signal",
+			script: "kill -TERM $$",
+
+			want: 128 + 15,
+		},
+		{
+			name:    "finished before timeout",
+			script:  "exit 2",
+			timeout: time.Minute,
+
+			want: 2,
+		},
+		{
+			name:    "exit code of a timeout before the timeout",
+			script:  "exit 124",
+			timeout: time.Minute,
+
+			want: exitTimedOut,
+		},
+		{
+			name:    "timed out",
+			script:  "sleep 10",
+			timeout: 50 * time.Millisecond,
+
+			want:         exitTimedOut,
+			wantTimedOut: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, timedOut, err := runCommand(exec.Command("sh", "-c", tc.script), tc.timeout)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want || timedOut != tc.wantTimedOut {
+				t.Errorf("got exit code %d, timed out %v, want %d, %v", got, timedOut, tc.want, tc.wantTimedOut)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Step is a single named command in a runbook spell.
+type Step struct {
+	Name    string
+	Command string
+}
+
+// stepNameRegex matches the names that steps can be given. Names are a single
+// word, so that a command such as "echo hello: world" isn't read as a name.
+var stepNameRegex = regexp.MustCompile(`^[\w.-]+$`)
+
+// parseStep parses the value of a Step header, written as "name: command".
+// A step without a name is just its command. If the command starts with a
+// word followed by ": ", which would be read as a name, the command is written
+// after an empty name instead, as ": command".
+func parseStep(value string) Step {
+	value = strings.TrimSpace(value)
+	name, command, ok := strings.Cut(value, ": ")
+	if ok && (name == "" || stepNameRegex.MatchString(name)) {
+		return Step{Name: strings.TrimSpace(name), Command: strings.TrimSpace(command)}
+	}
+	return Step{Command: value}
+}
+
+// formatStep formats a step as the value of a Step header, such that
+// parseStep reads back the same step.
+func formatStep(step Step) string {
+	if step.Name != "" {
+		return step.Name + ": " + step.Command
+	}
+	if parseStep(step.Command) != step {
+		return ": " + step.Command
+	}
+	return step.Command
+}
+
+// runbookProgress records where a runbook stopped, so that it can be resumed
+// from the same step with the same parameter values.
+type runbookProgress struct {
+	Step   int               `json:"step"`
+	Params map[string]string `json:"params"`
+}
+
+func runbookProgressPath(statePath, name string) string {
+	return filepath.Join(statePath, "runbooks", name+".json")
+}
+
+func readRunbookProgress(statePath, name string) (*runbookProgress, error) {
+	contents, err := os.ReadFile(runbookProgressPath(statePath, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var progress runbookProgress
+	if err := json.Unmarshal(contents, &progress); err != nil {
+		return nil, parseErrorf("runbook %s progress: %v", name, err)
+	}
+
+	return &progress, nil
+}
+
+func writeRunbookProgress(statePath, name string, progress runbookProgress) error {
+	path := runbookProgressPath(statePath, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	contents, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, contents, 0644)
+}
+
+func removeRunbookProgress(statePath, name string) error {
+	err := os.Remove(runbookProgressPath(statePath, name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// stepLabel names a step for display, numbered from 1.
+func stepLabel(entry Entry, i int) string {
+	label := fmt.Sprintf("Step %d/%d", i+1, len(entry.Steps))
+	if entry.Steps[i].Name != "" {
+		label += ": " + entry.Steps[i].Name
+	}
+	return label
+}
+
+// choose asks which of the options to take. Tests replace it to answer
+// without a terminal.
+var choose = promptWithTabCycling
+
+// castRunbook casts the steps of a runbook one at a time, asking before each
+// whether to run it, skip it, or abort the runbook. Parameters are prompted for
+// once up front. If a step fails or the runbook is aborted, the step is saved
+// so that the next cast of the runbook can resume from it.
+func castRunbook(conf Config, entry Entry, preset map[string]string, yes bool) error {
+	progress, err := readRunbookProgress(conf.StatePath, entry.Name)
+	if err != nil {
+		return err
+	}
+
+	start := 0
+	if progress != nil && progress.Step < len(entry.Steps) {
+		fmt.Printf("Runbook %s stopped at %s\n", entry.Name, stepLabel(entry, progress.Step))
+
+		action, err := choose([]string{"resume", "restart"})
+		if err != nil {
+			return err
+		}
+
+		switch action {
+		case "resume":
+			start = progress.Step
+			preset = progress.Params
+		case "restart":
+		default:
+			return errCancelled
+		}
+	}
+
+	t, values, err := resolveParams(conf, entry, preset)
+	if err != nil {
+		return err
+	}
+
+	// stop saves the step that the runbook stopped at for it to be resumed
+	stop := func(i int) {
+		err := writeRunbookProgress(conf.StatePath, entry.Name, runbookProgress{Step: i, Params: values})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: saving runbook progress: %v\n", err)
+			return
+		}
+		fmt.Printf("Runbook %s stopped at %s, cast it again to resume\n", entry.Name, stepLabel(entry, i))
+	}
+
+	for i := start; i < len(entry.Steps); i++ {
+		inc, err := t.Incantation(conf, entry, values)
+		if err != nil {
+			return err
+		}
+
+		inc.Step = entry.Steps[i].Name
+		inc.Command, err = t.Steps[i].Substitute(values)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s\n", stepLabel(entry, i))
+		fmt.Printf("  %s\n", inc.Command)
+
+		action := "run"
+		if !yes {
+			action, err = choose([]string{"run", "skip", "abort"})
+			if err != nil {
+				return err
+			}
+		}
+
+		switch action {
+		case "run":
+		case "skip":
+			continue
+		default:
+			stop(i)
+			return errCancelled
+		}
+
+		if matches := checkDanger(conf.DangerRules, inc.Command, entry.Allow); len(matches) > 0 {
+			ok, err := confirmDanger(entry.Name, inc.Command, matches)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				stop(i)
+				return errCancelled
+			}
+		}
+
+		if err := castIncantation(conf, inc); err != nil {
+			stop(i)
+			return err
+		}
+	}
+
+	return removeRunbookProgress(conf.StatePath, entry.Name)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestParseStep(t *testing.T) {
+	var testCases = []struct {
+		name  string
+		value string
+
+		want Step
+	}{
+		{
+			name:  "named step",
+			value: "drain: kubectl drain <node>",
+
+			want: Step{Name: "drain", Command: "kubectl drain <node>"},
+		},
+		{
+			name:  "command containing colons",
+			value: "check: curl -s http://<host>:8080/health",
+
+			want: Step{Name: "check", Command: "curl -s http://<host>:8080/health"},
+		},
+		{
+			name:  "unnamed step",
+			value: "systemctl restart postgresql",
+
+			want: Step{Command: "systemctl restart postgresql"},
+		},
+		{
+			name:  "unnamed step containing a colon",
+			value: `echo "a: b"`,
+
+			want: Step{Command: `echo "a: b"`},
+		},
+		{
+			name:  "unnamed step with words before a colon",
+			value: "echo hello: world",
+
+			want: Step{Command: "echo hello: world"},
+		},
+		{
+			name:  "unnamed step with a header",
+			value: "curl -H Accept: json <url>",
+
+			want: Step{Command: "curl -H Accept: json <url>"},
+		},
+		{
+			name:  "unnamed step after an empty name",
+			value: ": echo: a",
+
+			want: Step{Command: "echo: a"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseStep(tc.value)
+			if got != tc.want {
+				t.Errorf("got %#v, want %#v", got, tc.want)
+			}
+
+			if formatted := formatStep(got); formatted != tc.value {
+				t.Errorf("formatted as '%s', want '%s'", formatted, tc.value)
+			}
+		})
+	}
+}
+
+func TestFormatStep(t *testing.T) {
+	for _, step := range []Step{
+		{Name: "drain", Command: "kubectl drain <node>"},
+		{Name: "check", Command: "curl -s http://<host>:8080/health"},
+		{Command: "systemctl restart postgresql"},
+		{Command: `echo "a: b"`},
+		{Command: "echo a: b"},
+		{Command: "echo: a"},
+		{Command: ": noop"},
+	} {
+		if got := parseStep(formatStep(step)); got != step {
+			t.Errorf("%#v formatted as %q, which parses as %#v", step, formatStep(step), got)
+		}
+	}
+}
+
+func TestCastRunbook(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	conf := Config{StatePath: t.TempDir(), Interpreter: "sh"}
+
+	// The second step fails the first time it is run
+	entry := Entry{
+		Name: "upgrade",
+		Steps: []Step{
+			{Name: "first", Command: "echo first <version> >> " + log},
+			{Name: "second", Command: "test -e " + filepath.Join(dir, "ok") + " || { touch " + filepath.Join(dir, "ok") + "; exit 1; }; echo second <version> >> " + log},
+			{Name: "third", Command: "echo third <version> >> " + log},
+		},
+	}
+
+	// cast casts the runbook, answering each choice in turn
+	cast := func(preset map[string]string, answers ...string) error {
+		t.Helper()
+		t.Cleanup(func() { choose = promptWithTabCycling })
+		choose = func(options []string) (string, error) {
+			if len(answers) == 0 {
+				t.Fatalf("unexpected choice of %v", options)
+			}
+			answer := answers[0]
+			answers = answers[1:]
+			return answer, nil
+		}
+
+		err := castRunbook(conf, entry, preset, false)
+		if len(answers) > 0 {
+			t.Errorf("choices %v weren't asked for", answers)
+		}
+		return err
+	}
+
+	// checkLog checks the lines the steps have logged so far
+	checkLog := func(want string) {
+		t.Helper()
+		got, err := os.ReadFile(log)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", string(got), want, test.Diff(string(got), want))
+		}
+	}
+
+	// Aborting at the first step saves it to resume from
+	err := cast(map[string]string{"version": "1.2"}, "abort")
+	if !errors.Is(err, errCancelled) {
+		t.Fatalf("got error %v, want %v", err, errCancelled)
+	}
+	checkLog("")
+
+	// Restarting asks for the parameters again, and a failing step stops the
+	// runbook
+	err = cast(map[string]string{"version": "1.3"}, "restart", "run", "run")
+	var failed *spellFailedError
+	if !errors.As(err, &failed) {
+		t.Fatalf("got error %v, want the step's failure", err)
+	}
+	checkLog("first 1.3\n")
+
+	progress, err := readRunbookProgress(conf.StatePath, entry.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &runbookProgress{Step: 1, Params: map[string]string{"version": "1.3"}}
+	if !reflect.DeepEqual(progress, want) {
+		t.Errorf("got progress %#v, want %#v", progress, want)
+	}
+
+	// Resuming starts from the failed step with the same parameters, and a
+	// skipped step isn't run
+	if err := cast(nil, "resume", "run", "skip"); err != nil {
+		t.Fatal(err)
+	}
+	checkLog("first 1.3\nsecond 1.3\n")
+
+	// Finishing the runbook forgets its progress
+	progress, err = readRunbookProgress(conf.StatePath, entry.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress != nil {
+		t.Errorf("got progress %#v after finishing, want none", progress)
+	}
+}
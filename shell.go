@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+)
+
+// shellWidgets bind Ctrl+G to find a spell, prompt for its parameters, and
+// insert the final command at the cursor for it to be changed or run from the
+// shell itself.
+var shellWidgets = map[string]string{
+	"bash": `__grimoire_widget() {
+	local spell
+	spell="$(grimoire cast --print </dev/tty)" || return
+	READLINE_LINE="${READLINE_LINE:0:$READLINE_POINT}${spell}${READLINE_LINE:$READLINE_POINT}"
+	READLINE_POINT=$((READLINE_POINT + ${#spell}))
+}
+bind -x '"\C-g": __grimoire_widget'
+`,
+	"zsh": `__grimoire_widget() {
+	local spell
+	spell="$(grimoire cast --print </dev/tty)"
+	if [[ $? -eq 0 ]]; then
+		LBUFFER="${LBUFFER}${spell}"
+	fi
+	zle reset-prompt
+}
+zle -N __grimoire_widget
+bindkey '^G' __grimoire_widget
+`,
+	"fish": `function __grimoire_widget
+	set -l spell (grimoire cast --print </dev/tty | string collect)
+	and commandline --insert -- $spell
+	commandline --function repaint
+end
+bind \cg __grimoire_widget
+`,
+}
+
+// shellInitCommand prints the code to integrate grimoire with a shell, which
+// is meant to be evaluated in the shell's startup file.
+func shellInitCommand(args []string) error {
+	if len(args) != 1 {
+		return usageErrorf("expected one of: bash, zsh, fish")
+	}
+
+	widget, ok := shellWidgets[args[0]]
+	if !ok {
+		return usageErrorf("unsupported shell: %s", args[0])
+	}
+
+	fmt.Print(widget)
+
+	return nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// shellHistoryPath returns where the shell keeps its history, which for bash
+// and zsh may be changed with $HISTFILE.
+func shellHistoryPath(shell string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	switch shell {
+	case "bash", "zsh":
+		if histfile := os.Getenv("HISTFILE"); histfile != "" {
+			return histfile, nil
+		}
+		return filepath.Join(home, "."+shell+"_history"), nil
+	case "fish":
+		dataHome := os.Getenv("XDG_DATA_HOME")
+		if dataHome == "" {
+			dataHome = filepath.Join(home, ".local/share")
+		}
+		return filepath.Join(dataHome, "fish", "fish_history"), nil
+	default:
+		return "", fmt.Errorf("can't read history of %s, expected bash, zsh or fish", shell)
+	}
+}
+
+// parseBashHistory returns the commands in a bash history file, skipping the
+// timestamps written when $HISTTIMEFORMAT is set.
+func parseBashHistory(contents string) []string {
+	var commands []string
+	for _, line := range strings.Split(contents, "\n") {
+		if line == "" {
+			continue
+		}
+		if timestamp, ok := strings.CutPrefix(line, "#"); ok {
+			if _, err := strconv.Atoi(timestamp); err == nil {
+				continue
+			}
+		}
+		commands = append(commands, line)
+	}
+	return commands
+}
+
+// zshMeta is the byte zsh writes before a byte of its history file that it
+// has changed so as not to be mistaken for one of its own tokens.
+const zshMeta = 0x83
+
+// parseZshHistory returns the commands in a zsh history file, which may be in
+// the extended format of ": <time>:<duration>;<command>". Commands over
+// several lines end every line but the last with a backslash.
+func parseZshHistory(contents string) []string {
+	// Restore the bytes zsh changed, which are any outside of ASCII
+	var b strings.Builder
+	for i := 0; i < len(contents); i++ {
+		if contents[i] == zshMeta && i+1 < len(contents) {
+			i++
+			b.WriteByte(contents[i] ^ 32)
+		} else {
+			b.WriteByte(contents[i])
+		}
+	}
+
+	var commands []string
+	var command []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if len(command) == 0 {
+			if strings.HasPrefix(line, ": ") {
+				if _, rest, ok := strings.Cut(line, ";"); ok {
+					line = rest
+				}
+			}
+			if line == "" {
+				continue
+			}
+		}
+
+		if continued, ok := strings.CutSuffix(line, "\\"); ok {
+			command = append(command, continued)
+			continue
+		}
+
+		commands = append(commands, strings.Join(append(command, line), "\n"))
+		command = nil
+	}
+
+	return commands
+}
+
+// parseFishHistory returns the commands in a fish history file, which has a
+// "- cmd: <command>" line for each command with newlines and backslashes
+// escaped.
+func parseFishHistory(contents string) []string {
+	unescape := strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+
+	var commands []string
+	for _, line := range strings.Split(contents, "\n") {
+		if command, ok := strings.CutPrefix(line, "- cmd: "); ok {
+			commands = append(commands, unescape.Replace(command))
+		}
+	}
+	return commands
+}
+
+// readShellHistory returns the commands in the shell's history, most recent
+// first and without repeats.
+func readShellHistory(shell string) ([]string, error) {
+	path, err := shellHistoryPath(shell)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var commands []string
+	switch shell {
+	case "bash":
+		commands = parseBashHistory(string(contents))
+	case "zsh":
+		commands = parseZshHistory(string(contents))
+	case "fish":
+		commands = parseFishHistory(string(contents))
+	}
+
+	var recent []string
+	seen := make(map[string]bool)
+	for i := len(commands) - 1; i >= 0; i-- {
+		command := strings.TrimSpace(commands[i])
+		if command == "" || seen[command] {
+			continue
+		}
+		seen[command] = true
+		recent = append(recent, command)
+	}
+
+	return recent, nil
+}
+
+// pickFromHistory lets the user pick a command from the shell's history with
+// fzf, returning "" if nothing was picked.
+func pickFromHistory(shell string) (string, error) {
+	if shell == "" {
+		shell = filepath.Base(os.Getenv("SHELL"))
+	}
+
+	commands, err := readShellHistory(shell)
+	if err != nil {
+		return "", fmt.Errorf("reading %s history: %w", shell, err)
+	}
+
+	i, err := findLine(commands)
+	if err != nil || i < 0 {
+		return "", err
+	}
+
+	// Spells are kept on a single line
+	return joinLines(commands[i]), nil
+}
+
+// wordRegex matches each word of a command that can be marked as a parameter.
+var wordRegex = regexp.MustCompile(`\S+`)
+
+// redirectRegex matches a redirection at the start of a word, such as >
+// in >build.log, which is kept in the command when the word is marked.
+var redirectRegex = regexp.MustCompile(`^(\d*>>?|&>>?|<)`)
+
+// markPlaceholders turns words of a command into parameters, given marks such
+// as "2=host 4=port" that number the words from 1. A word marked without a
+// name, such as "4", is named after its position. Each parameter defaults to
+// the word it replaced, unless the word can't be written as a default. A
+// redirection at the start of a word is left in place, so only the file it
+// names becomes the parameter.
+func markPlaceholders(command, marks string) (string, error) {
+	words := wordRegex.FindAllStringIndex(command, -1)
+	names := make(map[int]string)
+	used := commandParams(command)
+
+	for _, mark := range strings.Fields(marks) {
+		number, name, _ := strings.Cut(mark, "=")
+		n, err := strconv.Atoi(number)
+		if err != nil || n < 1 || n > len(words) {
+			return "", fmt.Errorf("expected a word number from 1 to %d, got %s", len(words), number)
+		}
+		if name == "" {
+			name = fmt.Sprintf("arg%d", n)
+		}
+		if len(name) < 2 || strings.ContainsAny(name, "<>=; \t") {
+			return "", fmt.Errorf("invalid parameter name %q", name)
+		}
+		if used[name] {
+			return "", fmt.Errorf("parameter name %s is already used by the command", name)
+		}
+		for _, other := range names {
+			if other == name {
+				return "", fmt.Errorf("parameter name %s is used twice", name)
+			}
+		}
+		names[n-1] = name
+	}
+
+	var b strings.Builder
+	last := 0
+	for i, word := range words {
+		name, ok := names[i]
+		if !ok {
+			continue
+		}
+
+		b.WriteString(command[last:word[0]])
+		value := command[word[0]:word[1]]
+		if redirect := redirectRegex.FindString(value); redirect != "" {
+			value = strings.TrimPrefix(value, redirect)
+			if value == "" {
+				return "", fmt.Errorf("word %d is a redirection, mark the word after it instead", i+1)
+			}
+			b.WriteString(redirect)
+			// A < straight before the parameter would be read as part of it
+			if redirect == "<" {
+				b.WriteString(" ")
+			}
+		}
+		if strings.ContainsAny(value, "<>;") {
+			fmt.Fprintf(&b, "<%s>", name)
+		} else {
+			fmt.Fprintf(&b, "<%s=%s>", name, value)
+		}
+		last = word[1]
+	}
+	b.WriteString(command[last:])
+
+	return b.String(), nil
+}
+
+// promptPlaceholders shows the words of a command numbered and asks which of
+// them should become parameters.
+func promptPlaceholders(command string) (string, error) {
+	words := wordRegex.FindAllString(command, -1)
+	for i, word := range words {
+		fmt.Fprintf(promptOut, "%3d %s\n", i+1, word)
+	}
+
+	for {
+		fmt.Fprint(promptOut, "Parameters (such as 2=host 4=port, blank for none)>")
+		if !input.Scan() {
+			fmt.Fprintln(promptOut)
+			return command, input.Err()
+		}
+
+		marked, err := markPlaceholders(command, input.Text())
+		if err == nil {
+			return marked, nil
+		}
+		fmt.Fprintf(promptOut, "%v\n", err)
+	}
+}
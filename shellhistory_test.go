@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestParseShellHistory(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		parse    func(string) []string
+		contents string
+
+		want []string
+	}{
+		{
+			name:     "bash",
+			parse:    parseBashHistory,
+			contents: "ls -la\n#1700000000\ngit status\n# not a timestamp\n",
+
+			want: []string{"ls -la", "git status", "# not a timestamp"},
+		},
+		{
+			name:     "zsh extended",
+			parse:    parseZshHistory,
+			contents: ": 1700000000:0;ls -la\n: 1700000001:3;for f in *; do\\\necho $f\\\ndone\necho caf\x83\x29\n",
+
+			want: []string{"ls -la", "for f in *; do\necho $f\ndone", "echo caf\x09"},
+		},
+		{
+			name:     "fish",
+			parse:    parseFishHistory,
+			contents: "- cmd: ls -la\n  when: 1700000000\n- cmd: echo a\\nb \\\\n\n  when: 1700000001\n  paths:\n    - b\n",
+
+			want: []string{"ls -la", "echo a\nb \\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.parse(tc.contents)
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+		})
+	}
+}
+
+func TestMarkPlaceholders(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		command string
+		marks   string
+
+		want string
+		err  error
+	}{
+		{
+			name:    "ok - no marks",
+			command: "ssh admin@10.0.3.7 -p 2222",
+			marks:   "",
+
+			want: "ssh admin@10.0.3.7 -p 2222",
+		},
+		{
+			name:    "ok - named marks",
+			command: "ssh admin@10.0.3.7  -p 2222",
+			marks:   "4=port 2=host",
+
+			want: "ssh <host=admin@10.0.3.7>  -p <port=2222>",
+		},
+		{
+			name:    "ok - unnamed mark",
+			command: "ping -c 3 example.com",
+			marks:   "4",
+
+			want: "ping -c 3 <arg4=example.com>",
+		},
+		{
+			name:    "ok - word that can't be a default",
+			command: "grep -e a;b file",
+			marks:   "3=pattern",
+
+			want: "grep -e <pattern> file",
+		},
+		{
+			name:    "ok - input redirection",
+			command: "sort <input.txt",
+			marks:   "2=input",
+
+			want: "sort < <input=input.txt>",
+		},
+		{
+			name:    "ok - output redirection",
+			command: "make >build.log 2>>errors.log",
+			marks:   "2=log 3=errors",
+
+			want: "make ><log=build.log> 2>><errors=errors.log>",
+		},
+		{
+			name:    "error - redirection on its own",
+			command: "make > build.log",
+			marks:   "2=log",
+
+			err: fmt.Errorf("word 2 is a redirection, mark the word after it instead"),
+		},
+		{
+			name:    "error - no such word",
+			command: "ls -la",
+			marks:   "3=dir",
+
+			err: fmt.Errorf("expected a word number from 1 to 2, got 3"),
+		},
+		{
+			name:    "error - same name twice",
+			command: "scp a b",
+			marks:   "2=file 3=file",
+
+			err: fmt.Errorf("parameter name file is used twice"),
+		},
+		{
+			name:    "error - name the command already has",
+			command: "ssh <host> other",
+			marks:   "3=host",
+
+			err: fmt.Errorf("parameter name host is already used by the command"),
+		},
+		{
+			name:    "error - invalid name",
+			command: "ls -la",
+			marks:   "2=a",
+
+			err: fmt.Errorf(`invalid parameter name "a"`),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := markPlaceholders(tc.command, tc.marks)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+
+			if result != tc.want {
+				t.Errorf("got %q, want %q", result, tc.want)
+			}
+		})
+	}
+}
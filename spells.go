@@ -2,10 +2,16 @@ package main
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
+// forgottenDir is the folder within the spell path that forgotten spells are
+// moved into, out of the way but still recoverable.
+const forgottenDir = "forgotten"
+
 func EnsurePathExists(spellPath string) error {
 	// Check if the spells directory exists, create if it doesn't
 	if _, err := os.Stat(spellPath); os.IsNotExist(err) {
@@ -20,17 +26,75 @@ func EnsurePathExists(spellPath string) error {
 }
 
 func SanitizeFilename(name string) string {
-	// Replace spaces with underscores and remove invalid characters
-	sanitized := strings.ReplaceAll(name, " ", "_")
-	sanitized = strings.ToLower(sanitized)
+	words := strings.Split(strings.ToLower(strings.TrimSpace(name)), " ")
+
+	// Remove characters that are not alphanumeric, underscore, or hyphen. A
+	// word made only of such characters is removed entirely, so "a @ b"
+	// becomes a_b rather than a__b.
+	var sanitized []string
+	for _, word := range words {
+		var result strings.Builder
+		for _, r := range word {
+			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+				result.WriteRune(r)
+			}
+		}
+
+		if word != "" && result.Len() == 0 {
+			continue
+		}
+		sanitized = append(sanitized, result.String())
+	}
+
+	// Replace spaces with underscores
+	return strings.Join(sanitized, "_")
+}
 
-	// Remove characters that are not alphanumeric, underscore, or hyphen
-	var result strings.Builder
-	for _, r := range sanitized {
-		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
-			result.WriteRune(r)
+// splitList splits a comma-delimited list, such as a spell's tags, trimming
+// whitespace around each item and dropping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
 		}
 	}
+	return items
+}
+
+// listSpells returns the names of the spells in spellPath, relative to it.
+// Hidden files and folders, such as .git, and forgotten spells are skipped.
+func listSpells(spellPath string) ([]string, error) {
+	var names []string
+
+	err := filepath.WalkDir(spellPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == spellPath {
+			return nil
+		}
+
+		forgotten := d.IsDir() && path == filepath.Join(spellPath, forgottenDir)
+		if strings.HasPrefix(d.Name(), ".") || forgotten {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.Type().IsRegular() {
+			name, err := filepath.Rel(spellPath, path)
+			if err != nil {
+				return err
+			}
+			names = append(names, name)
+		}
+
+		return nil
+	})
 
-	return result.String()
+	return names, err
 }
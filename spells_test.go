@@ -1,6 +1,13 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
 
 func TestSanitizeFilename(t *testing.T) {
 	var testCases = []struct {
@@ -45,3 +52,26 @@ func TestSanitizeFilename(t *testing.T) {
 		})
 	}
 }
+
+func TestListSpells(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"pods", "deploy", "k8s/logs", ".git/HEAD", ".hidden", "forgotten/old", "ops/forgotten/restore"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := listSpells(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"deploy", "k8s/logs", "ops/forgotten/restore", "pods"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", got, want, test.Diff(got, want))
+	}
+}
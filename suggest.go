@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Suggestion is a part of a command that looks like it could be a parameter,
+// such as an IP address or a path.
+type Suggestion struct {
+	Name  string
+	Value string
+	// Spans are where the value is in the command. A value used more than
+	// once becomes a single parameter.
+	Spans [][2]int
+}
+
+// suggester finds one kind of value in a command. The value is the pattern's
+// first group if it has one, or else the whole match.
+type suggester struct {
+	name    string
+	pattern *regexp.Regexp
+	// keep, if set, decides whether a value is really of this kind.
+	keep func(value string) bool
+}
+
+// hostTLDs are top-level domains that make a word like example.com a
+// hostname rather than a file name like notes.txt.
+var hostTLDs = []string{"com", "net", "org", "io", "dev", "app", "cloud", "co", "uk", "de", "local", "internal", "lan", "corp", "home"}
+
+// suggesters are tried in order, so that a value that looks like several
+// kinds, such as a URL containing a hostname, is suggested as the first.
+var suggesters = []suggester{
+	{name: "url", pattern: regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s'"]+`)},
+	{name: "id", pattern: regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)},
+	{name: "text", pattern: regexp.MustCompile(`"([^"\\]+)"|'([^']+)'`)},
+	{name: "user", pattern: regexp.MustCompile(`(?:^|[\s/])([\w.-]+)@[\w.-]+`)},
+	{name: "ip", pattern: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?:/\d{1,2})?\b`)},
+	{name: "port", pattern: regexp.MustCompile(`(?:^|\s)(?:-p|-P|--port)(?:\s+|=)(\d{1,5})\b`)},
+	{name: "port", pattern: regexp.MustCompile(`(?:[\w-]\.[\w.-]*|localhost):(\d{2,5})\b`)},
+	{name: "path", pattern: regexp.MustCompile(`(?:^|[\s=:])((?:~|\.\.?)?/[^\s'";|&<>]+)`)},
+	{
+		name:    "host",
+		pattern: regexp.MustCompile(`\b(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?\.)+[a-zA-Z]{2,}\b`),
+		keep: func(value string) bool {
+			return slices.Contains(hostTLDs, strings.ToLower(value[strings.LastIndex(value, ".")+1:]))
+		},
+	},
+}
+
+// suggestParams returns the parts of a command that look like they could be
+// parameters, in the order they appear. Parts of the command that are already
+// parameters are left alone.
+func suggestParams(command string) []Suggestion {
+	var taken [][2]int
+	for _, match := range paramRegex.FindAllStringIndex(command, -1) {
+		taken = append(taken, [2]int{match[0], match[1]})
+	}
+
+	overlaps := func(span [2]int) bool {
+		for _, t := range taken {
+			if span[0] < t[1] && t[0] < span[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	byValue := make(map[string]*Suggestion)
+	var suggestions []*Suggestion
+
+	for _, s := range suggesters {
+		for _, match := range s.pattern.FindAllStringSubmatchIndex(command, -1) {
+			span := [2]int{match[0], match[1]}
+			for i := 2; i < len(match); i += 2 {
+				if match[i] >= 0 {
+					span = [2]int{match[i], match[i+1]}
+					break
+				}
+			}
+
+			value := command[span[0]:span[1]]
+			if overlaps(span) || (s.keep != nil && !s.keep(value)) {
+				continue
+			}
+			taken = append(taken, span)
+
+			if suggestion, ok := byValue[value]; ok {
+				suggestion.Spans = append(suggestion.Spans, span)
+				continue
+			}
+
+			suggestion := &Suggestion{Name: s.name, Value: value, Spans: [][2]int{span}}
+			byValue[value] = suggestion
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		return suggestions[i].Spans[0][0] < suggestions[j].Spans[0][0]
+	})
+
+	// Number names that are used more than once, or by the command already
+	used := commandParams(command)
+
+	result := make([]Suggestion, len(suggestions))
+	for i, suggestion := range suggestions {
+		name := suggestion.Name
+		for n := 2; used[name]; n++ {
+			name = suggestion.Name + strconv.Itoa(n)
+		}
+		used[name] = true
+
+		suggestion.Name = name
+		result[i] = *suggestion
+	}
+
+	return result
+}
+
+// commandParams returns the names of the parameters a command already has.
+func commandParams(command string) map[string]bool {
+	names := make(map[string]bool)
+	if spell, err := ParseSpell(command); err == nil {
+		for _, param := range spell.Params {
+			names[param.Name] = true
+		}
+	}
+	return names
+}
+
+// applySuggestions rewrites a command with the suggestions as parameters. The
+// first use of each parameter defaults to the value it replaced, unless the
+// value can't be written as a default.
+func applySuggestions(command string, suggestions []Suggestion) string {
+	type replacement struct {
+		span [2]int
+		text string
+	}
+
+	var replacements []replacement
+	for _, s := range suggestions {
+		for i, span := range s.Spans {
+			text := "<" + s.Name + ">"
+			if i == 0 && !strings.ContainsAny(s.Value, "<>;") {
+				text = "<" + s.Name + "=" + s.Value + ">"
+			}
+			replacements = append(replacements, replacement{span: span, text: text})
+		}
+	}
+
+	sort.Slice(replacements, func(i, j int) bool {
+		return replacements[i].span[0] < replacements[j].span[0]
+	})
+
+	var b strings.Builder
+	last := 0
+	for _, r := range replacements {
+		b.WriteString(command[last:r.span[0]])
+		b.WriteString(r.text)
+		last = r.span[1]
+	}
+	b.WriteString(command[last:])
+
+	return b.String()
+}
+
+// chooseSuggestions returns the suggestions of a command chosen by an answer
+// such as "1 3=addr", which numbers the suggestions from 1 and may rename them,
+// or "all". A suggestion can't be renamed to a parameter the command already
+// has.
+func chooseSuggestions(command string, suggestions []Suggestion, answer string) ([]Suggestion, error) {
+	if strings.TrimSpace(answer) == "all" {
+		return suggestions, nil
+	}
+
+	var chosen []Suggestion
+	for _, choice := range strings.Fields(answer) {
+		number, name, renamed := strings.Cut(choice, "=")
+		n, err := strconv.Atoi(number)
+		if err != nil || n < 1 || n > len(suggestions) {
+			return nil, fmt.Errorf("expected a suggestion number from 1 to %d, got %s", len(suggestions), number)
+		}
+
+		suggestion := suggestions[n-1]
+		if renamed {
+			if len(name) < 2 || strings.ContainsAny(name, "<>=; \t") {
+				return nil, fmt.Errorf("invalid parameter name %q", name)
+			}
+			if commandParams(command)[name] {
+				return nil, fmt.Errorf("parameter name %s is already used by the command", name)
+			}
+			suggestion.Name = name
+		}
+
+		for _, c := range chosen {
+			if c.Name == suggestion.Name {
+				return nil, fmt.Errorf("parameter name %s is used twice", c.Name)
+			}
+		}
+		chosen = append(chosen, suggestion)
+	}
+
+	return chosen, nil
+}
+
+// promptSuggestions offers the parts of a command that look like parameters
+// and rewrites the command with the ones chosen.
+func promptSuggestions(command string) (string, error) {
+	suggestions := suggestParams(command)
+	if len(suggestions) == 0 {
+		return command, nil
+	}
+
+	width := 0
+	for _, s := range suggestions {
+		width = max(width, len(s.Name))
+	}
+
+	fmt.Fprintln(promptOut, "Suggested parameters:")
+	for i, s := range suggestions {
+		fmt.Fprintf(promptOut, "%3d %-*s  %s\n", i+1, width, s.Name, s.Value)
+	}
+
+	for {
+		fmt.Fprint(promptOut, "Use (such as 1 2=addr, all, blank for none)>")
+		if !input.Scan() {
+			fmt.Fprintln(promptOut)
+			return command, input.Err()
+		}
+
+		chosen, err := chooseSuggestions(command, suggestions, input.Text())
+		if err == nil {
+			return applySuggestions(command, chosen), nil
+		}
+		fmt.Fprintf(promptOut, "%v\n", err)
+	}
+}
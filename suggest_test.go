@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"toddgaunt.com/grimoire/test"
+)
+
+func TestSuggestParams(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		command string
+
+		want []Suggestion
+	}{
+		{
+			name:    "nothing to suggest",
+			command: "git status",
+		},
+		{
+			name:    "user, ip and port",
+			command: "ssh admin@10.0.3.7 -p 2222",
+
+			want: []Suggestion{
+				{Name: "user", Value: "admin", Spans: [][2]int{{4, 9}}},
+				{Name: "ip", Value: "10.0.3.7", Spans: [][2]int{{10, 18}}},
+				{Name: "port", Value: "2222", Spans: [][2]int{{22, 26}}},
+			},
+		},
+		{
+			name:    "url rather than the host in it",
+			command: "curl -s https://api.example.com/v1/health",
+
+			want: []Suggestion{
+				{Name: "url", Value: "https://api.example.com/v1/health", Spans: [][2]int{{8, 41}}},
+			},
+		},
+		{
+			name:    "host and port, but not a file name",
+			command: "nc -v db.example.internal:5432 < notes.txt",
+
+			want: []Suggestion{
+				{Name: "host", Value: "db.example.internal", Spans: [][2]int{{6, 25}}},
+				{Name: "port", Value: "5432", Spans: [][2]int{{26, 30}}},
+			},
+		},
+		{
+			name:    "repeated paths are one parameter, and quoted text",
+			command: `cp ~/notes.md /tmp/x && grep "TODO list" ~/notes.md`,
+
+			want: []Suggestion{
+				{Name: "path", Value: "~/notes.md", Spans: [][2]int{{3, 13}, {41, 51}}},
+				{Name: "path2", Value: "/tmp/x", Spans: [][2]int{{14, 20}}},
+				{Name: "text", Value: "TODO list", Spans: [][2]int{{30, 39}}},
+			},
+		},
+		{
+			name:    "uuid, next to an existing parameter",
+			command: "kubectl delete pod <pod> --uid 123e4567-e89b-12d3-a456-426614174000",
+
+			want: []Suggestion{
+				{Name: "id", Value: "123e4567-e89b-12d3-a456-426614174000", Spans: [][2]int{{31, 67}}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := suggestParams(tc.command)
+			if len(result) == 0 && len(tc.want) == 0 {
+				return
+			}
+
+			if !reflect.DeepEqual(result, tc.want) {
+				t.Errorf("unexpected result\ngot: %#v\nwant:%#v\ndiff: %s", result, tc.want, test.Diff(result, tc.want))
+			}
+		})
+	}
+}
+
+func TestChooseSuggestions(t *testing.T) {
+	command := `cp ~/notes.md /tmp/x && grep "TODO list" ~/notes.md | head -n <lines>`
+	suggestions := suggestParams(command)
+
+	var testCases = []struct {
+		name   string
+		answer string
+
+		want string
+		err  error
+	}{
+		{
+			name:   "ok - none",
+			answer: "",
+
+			want: command,
+		},
+		{
+			name:   "ok - all",
+			answer: "all",
+
+			want: `cp <path=~/notes.md> <path2=/tmp/x> && grep "<text=TODO list>" <path> | head -n <lines>`,
+		},
+		{
+			name:   "ok - some, renamed",
+			answer: "3=pattern 1=file",
+
+			want: `cp <file=~/notes.md> /tmp/x && grep "<pattern=TODO list>" <file> | head -n <lines>`,
+		},
+		{
+			name:   "error - no such suggestion",
+			answer: "4",
+
+			err: fmt.Errorf("expected a suggestion number from 1 to 3, got 4"),
+		},
+		{
+			name:   "error - same name twice",
+			answer: "1=file 2=file",
+
+			err: fmt.Errorf("parameter name file is used twice"),
+		},
+		{
+			name:   "error - name the command already has",
+			answer: "1=lines",
+
+			err: fmt.Errorf("parameter name lines is already used by the command"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			chosen, err := chooseSuggestions(command, suggestions, tc.answer)
+
+			if !test.ErrorTextEqual(err, tc.err) {
+				t.Fatalf("got error %q, want error %q", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if result := applySuggestions(command, chosen); result != tc.want {
+				t.Errorf("got %q, want %q", result, tc.want)
+			}
+		})
+	}
+}